@@ -0,0 +1,283 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Default limit of the request body size for Bind
+const defaultMaxBodySize = 10 << 20
+
+var (
+	// ErrUnsupportedMediaType is returned by Bind if the content type
+	// of the request body is not supported.
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+	// ErrBodyTooLarge is returned by Bind if the request body
+	// exceeds the limit defined by SetupMaxBodySize.
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
+var (
+	fileHeaderType   = reflect.TypeOf((*multipart.FileHeader)(nil))
+	textUnmarshaller = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// limitedBody reads the request body up to the limit and remembers
+// whether the limit is exceeded.
+type limitedBody struct {
+	io.ReadCloser
+	left     int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		// check that there is no more data
+		var buf [1]byte
+		if n, _ := b.ReadCloser.Read(buf[:]); n > 0 {
+			b.exceeded = true
+			return 0, ErrBodyTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+
+	return n, err
+}
+
+// Bind decodes the request into the struct and validates it.
+func (c *control) Bind(v interface{}) error {
+	limit := int64(defaultMaxBodySize)
+	if c.router != nil && c.router.maxBodySize > 0 {
+		limit = c.router.maxBodySize
+	}
+	var body *limitedBody
+	if c.req.Body != nil && c.req.Body != http.NoBody {
+		body = &limitedBody{ReadCloser: c.req.Body, left: limit}
+		c.req.Body = body
+	}
+	err := c.decode(v, limit)
+	if body != nil && body.exceeded {
+		return ErrBodyTooLarge
+	}
+	if err == ErrUnsupportedMediaType {
+		return err
+	}
+	if err != nil {
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
+	if err := bindValues(v, c); err != nil {
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
+	var custom map[string]func(interface{}, string) bool
+	if c.router != nil {
+		custom = c.router.validators
+	}
+
+	return validate(v, custom)
+}
+
+// decode decodes the request body according to its content type
+func (c *control) decode(v interface{}, limit int64) error {
+	if c.req.Body == nil || c.req.Body == http.NoBody || c.req.ContentLength == 0 {
+		return nil
+	}
+	contentType := c.req.Header.Get("Content-Type")
+	if contentType == "" {
+		return ErrUnsupportedMediaType
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ErrUnsupportedMediaType
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if err := json.NewDecoder(c.req.Body).Decode(v); err != nil && err != io.EOF {
+			return err
+		}
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		if err := xml.NewDecoder(c.req.Body).Decode(v); err != nil && err != io.EOF {
+			return err
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		return c.req.ParseForm()
+	case mediaType == "multipart/form-data":
+		return c.req.ParseMultipartForm(limit)
+	default:
+		return ErrUnsupportedMediaType
+	}
+
+	return nil
+}
+
+// values returns values of the request by tag of the struct field:
+// `param` for path parameters, `query` for URL query, `form` for form values.
+func (c *control) values(tag, key string) []string {
+	switch tag {
+	case "param":
+		if key[0] != ':' && key[0] != '*' {
+			key = ":" + key
+		}
+		if value, ok := c.params.Get(key); ok {
+			return []string{value}
+		}
+	case "query":
+		return c.req.URL.Query()[key]
+	case "form":
+		if c.req.MultipartForm != nil {
+			return c.req.MultipartForm.Value[key]
+		}
+		return c.req.PostForm[key]
+	}
+
+	return nil
+}
+
+// files returns uploaded files of the multipart form by key
+func (c *control) files(key string) []*multipart.FileHeader {
+	if c.req.MultipartForm == nil {
+		return nil
+	}
+
+	return c.req.MultipartForm.File[key]
+}
+
+// source provides values and uploaded files of the request for binding
+type source interface {
+	values(tag, key string) []string
+	files(key string) []*multipart.FileHeader
+}
+
+// bindValues fills fields of the struct which have `param`, `query` and `form` tags
+func bindValues(v interface{}, src source) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return bindStruct(rv, src)
+}
+
+func bindStruct(rv reflect.Value, src source) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		field := rv.Field(i)
+		if sf.Anonymous && field.Kind() == reflect.Struct {
+			if err := bindStruct(field, src); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		for _, tag := range []string{"form", "query", "param"} {
+			key := sf.Tag.Get(tag)
+			if key == "" || key == "-" {
+				continue
+			}
+			if tag == "form" && (field.Type() == fileHeaderType || field.Type() == reflect.SliceOf(fileHeaderType)) {
+				bindFiles(field, src.files(key))
+				continue
+			}
+			if data := src.values(tag, key); len(data) > 0 {
+				if err := setField(field, data); err != nil {
+					return fmt.Errorf("%s %q: %v", tag, key, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func bindFiles(field reflect.Value, files []*multipart.FileHeader) {
+	if len(files) == 0 {
+		return
+	}
+	if field.Kind() == reflect.Slice {
+		field.Set(reflect.ValueOf(files))
+		return
+	}
+	field.Set(reflect.ValueOf(files[0]))
+}
+
+// setField converts the values into the type of the field
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return setField(field.Elem(), values)
+	}
+	if field.CanAddr() && field.Addr().Type().Implements(textUnmarshaller) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+	}
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for idx, value := range values {
+			if err := setField(slice.Index(idx), []string{value}); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	value := values[0]
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
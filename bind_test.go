@@ -0,0 +1,187 @@
+package bit
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindUser struct {
+	ID      int       `param:"id" json:"-" xml:"-"`
+	Name    string    `json:"name" xml:"name" form:"name"`
+	Age     uint8     `json:"age" xml:"age" form:"age"`
+	Tags    []string  `json:"-" xml:"-" query:"tag"`
+	Page    *int      `json:"-" xml:"-" query:"page"`
+	Active  bool      `json:"-" xml:"-" query:"active"`
+	Score   float64   `json:"-" xml:"-" form:"score"`
+	Created time.Time `json:"-" xml:"-" query:"created"`
+}
+
+func bindRequest(method, path, pattern, contentType, body string, v interface{}) error {
+	var err error
+	r := getRouterForTesting()
+	r.Handle(method, pattern, func(c Control) {
+		err = c.Bind(v)
+	})
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	return err
+}
+
+func TestBindJSON(t *testing.T) {
+	var user bindUser
+	err := bindRequest("PUT", "/users/12?tag=a&tag=b&page=3&active=true&created=2017-10-01T17:33:56Z",
+		"/users/:id", "application/json; charset=utf-8", `{"name":"John","age":32}`, &user)
+	if err != nil {
+		t.Fatal("Expected nil error, got", err)
+	}
+	if user.ID != 12 || user.Name != "John" || user.Age != 32 {
+		t.Error("Expected 12 John 32, got", user.ID, user.Name, user.Age)
+	}
+	if len(user.Tags) != 2 || user.Tags[0] != "a" || user.Tags[1] != "b" {
+		t.Error("Expected tags [a b], got", user.Tags)
+	}
+	if user.Page == nil || *user.Page != 3 {
+		t.Error("Expected page 3, got", user.Page)
+	}
+	if !user.Active {
+		t.Error("Expected active true, got", user.Active)
+	}
+	if user.Created.Year() != 2017 {
+		t.Error("Expected created in 2017, got", user.Created)
+	}
+}
+
+func TestBindXML(t *testing.T) {
+	var user bindUser
+	err := bindRequest("POST", "/users/7", "/users/:id<int>", "application/xml",
+		`<user><name>Jane</name><age>33</age></user>`, &user)
+	if err != nil {
+		t.Fatal("Expected nil error, got", err)
+	}
+	if user.ID != 7 || user.Name != "Jane" || user.Age != 33 {
+		t.Error("Expected 7 Jane 33, got", user.ID, user.Name, user.Age)
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	var user bindUser
+	err := bindRequest("POST", "/users", "/users", "application/x-www-form-urlencoded",
+		"name=John&age=32&score=4.5", &user)
+	if err != nil {
+		t.Fatal("Expected nil error, got", err)
+	}
+	if user.Name != "John" || user.Age != 32 || user.Score != 4.5 {
+		t.Error("Expected John 32 4.5, got", user.Name, user.Age, user.Score)
+	}
+	err = bindRequest("POST", "/users", "/users", "application/x-www-form-urlencoded", "age=old", &user)
+	if err == nil {
+		t.Error("Expected conversion error, got nil")
+	}
+}
+
+func TestBindMultipart(t *testing.T) {
+	var upload struct {
+		Name   string                  `form:"name"`
+		File   *multipart.FileHeader   `form:"file"`
+		Files  []*multipart.FileHeader `form:"file"`
+		Absent *multipart.FileHeader   `form:"absent"`
+	}
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	mw.WriteField("name", "avatar")
+	for _, name := range []string{"a.png", "b.png"} {
+		fw, _ := mw.CreateFormFile("file", name)
+		fw.Write([]byte("content"))
+	}
+	mw.Close()
+	err := bindRequest("POST", "/upload", "/upload", mw.FormDataContentType(), body.String(), &upload)
+	if err != nil {
+		t.Fatal("Expected nil error, got", err)
+	}
+	if upload.Name != "avatar" {
+		t.Error("Expected avatar, got", upload.Name)
+	}
+	if upload.File == nil || upload.File.Filename != "a.png" {
+		t.Error("Expected file a.png, got", upload.File)
+	}
+	if len(upload.Files) != 2 {
+		t.Error("Expected 2 files, got", len(upload.Files))
+	}
+	if upload.Absent != nil {
+		t.Error("Expected nil file, got", upload.Absent)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	var user bindUser
+	err := bindRequest("POST", "/users", "/users", "application/yaml", "name: John", &user)
+	if err != ErrUnsupportedMediaType {
+		t.Error("Expected", ErrUnsupportedMediaType, "got", err)
+	}
+	err = bindRequest("POST", "/users", "/users", "", "name=John", &user)
+	if err != ErrUnsupportedMediaType {
+		t.Error("Expected", ErrUnsupportedMediaType, "got", err)
+	}
+	err = bindRequest("POST", "/users", "/users", "application/json", `{"name":`, &user)
+	if err == nil {
+		t.Error("Expected decoding error, got nil")
+	}
+	// empty body is allowed
+	err = bindRequest("GET", "/users/1", "/users/:id", "", "", &user)
+	if err != nil || user.ID != 1 {
+		t.Error("Expected nil error and ID 1, got", err, user.ID)
+	}
+}
+
+func TestBindMaxBodySize(t *testing.T) {
+	r := getRouterForTesting()
+	r.SetupMaxBodySize(16)
+	var err error
+	r.POST("/users", func(c Control) {
+		var user bindUser
+		err = c.Bind(&user)
+	})
+	for _, contentType := range []string{"application/json", "application/x-www-form-urlencoded"} {
+		body := `{"name":"` + strings.Repeat("x", 32) + `"}`
+		if contentType != "application/json" {
+			body = "name=" + strings.Repeat("x", 32)
+		}
+		req := httptest.NewRequest("POST", "/users", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if err != ErrBodyTooLarge {
+			t.Error("Expected", ErrBodyTooLarge, "for", contentType, "got", err)
+		}
+	}
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"John"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Error("Expected nil error, got", err)
+	}
+}
+
+func TestBindWithoutRouter(t *testing.T) {
+	req := httptest.NewRequest("POST", "/users?page=2", strings.NewReader(`{"name":"John"}`))
+	req.Header.Set("Content-Type", "application/json")
+	c := NewControl(httptest.NewRecorder(), req)
+	var user bindUser
+	if err := c.Bind(&user); err != nil {
+		t.Fatal("Expected nil error, got", err)
+	}
+	if user.Name != "John" || user.Page == nil || *user.Page != 2 {
+		t.Error("Expected John and page 2, got", user.Name, user.Page)
+	}
+	var data map[string]interface{}
+	if err := c.Bind(&data); err != nil {
+		t.Error("Expected nil error for consumed body, got", err)
+	}
+}
@@ -4,15 +4,38 @@
 
 package bit
 
-import "net/http"
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+)
 
 // Control interface contains methods that control
 // URL/POST/JSON query parameters, handle request/response
 // and accelerate access to HTTP `Status Code`, `Body`.
+//
+// The Router reuses controls between requests, so the Control
+// must not be used after the handler returns.
 type Control interface {
 	// Request returns *http.Request
 	Request() *http.Request
 
+	// SetRequest replaces the request, e.g. by the request with updated context.
+	// The middleware uses it to pass the values to the handlers down the chain.
+	SetRequest(req *http.Request)
+
+	// Context returns the context of the request, it is canceled
+	// when the client's connection closes or ServeHTTP returns.
+	Context() context.Context
+
+	// Set stores the value by the key for the time of the request,
+	// e.g. the authenticated user or the trace started by the middleware.
+	Set(key string, value interface{})
+
+	// Get returns the value stored by Set and whether it is present.
+	Get(key string) (interface{}, bool)
+
 	// Params get embedded key/value data that contains URL/Post query parameters
 	Params() *Params
 
@@ -26,11 +49,75 @@ type Control interface {
 	// GetCode shows HTTP status code that set by Code()
 	GetCode() int
 
+	// StatusCode returns the status code actually sent to the client
+	// (via Body, Error, WriteHeader or Write), 0 if nothing is sent yet.
+	StatusCode() int
+
+	// BytesWritten returns the number of bytes of the body written to the client.
+	// The router compresses the reply until the end of the request, so the size
+	// of the compressed reply is counted before compression.
+	BytesWritten() int64
+
+	// Written checks whether the header of the reply is sent to the client.
+	// The middleware observes the status code and size of the reply after the call.
+	// The status code and the data which are buffered while the decision about
+	// compression is not made are reported by StatusCode, BytesWritten and Written
+	// as sent, the reply is not changed by these methods.
+	Written() bool
+
+	// Route returns the pattern of the matched route e.g. `/users/:id<int>`,
+	// which is suitable as low-cardinality label for metrics and tracing.
+	// It is empty if the route is not found or the method is not allowed.
+	Route() string
+
+	// ClientCertificate returns the certificate presented by the client
+	// over TLS, it is nil if there is no one. The certificate is verified
+	// if the server requires it e.g. by ServerOptions.ClientCAFile.
+	ClientCertificate() *x509.Certificate
+
+	// GetError returns the error returned by the handler registered via
+	// Router.HandleE or replied by Error, it is nil otherwise.
+	GetError() error
+
 	// Body writes prepared header, status code and body data into http output.
 	// It is equal to using sequence of http.ResponseWriter methods:
 	// WriteHeader(code int) and Write(b []byte) int, error
+	// The string data is written as is. Other data is encoded by the encoder
+	// registered by RegisterEncoder for the media type that has the highest quality
+	// in the `Accept` header (JSON, XML, MessagePack and plain text are supported
+	// out of the box, plain text is used for strings, Stringers and errors only).
+	// If the header is absent, JSON is used. If the encoder cannot encode the data,
+	// the next acceptable one is used. If none of the media types is acceptable,
+	// the status code 406 is replied by Error.
+	// ValidationErrors are replied with status code 422 unless other code is set.
 	Body(data interface{})
 
+	// Bind decodes the request into the struct pointed to by v.
+	// The body is decoded according to the `Content-Type` header: JSON, XML,
+	// URL-encoded and multipart forms are supported. Then the fields with tags
+	// `form`, `query` and `param` are filled by form values, URL query values
+	// and path parameters accordingly, e.g. `param:"id"` for `/users/:id`.
+	// The file fields of multipart forms have type *multipart.FileHeader
+	// or []*multipart.FileHeader. If the body is larger than the limit defined
+	// by SetupMaxBodySize, ErrBodyTooLarge is returned. ErrUnsupportedMediaType
+	// is returned for the body of unknown content type. Malformed data
+	// is reported by *Problem with status code 400.
+	// Finally the fields are validated by rules of `validate` tags,
+	// e.g. `validate:"required,min=1,email"`. Predefined rules are: required,
+	// omitempty, min, max, len, oneof, email, url, uuid, alpha, alnum, numeric.
+	// Other rules may be defined by Router.SetupValidator. If the struct
+	// is invalid, ValidationErrors is returned which may be passed to Body
+	// to reply with status code 422.
+	Bind(v interface{}) error
+
+	// Error replies to the request with the error as problem details
+	// of `application/problem+json` media type (RFC 7807). *Problem is
+	// replied as is, ValidationErrors with status code 422 and the list
+	// of invalid fields in `errors` member, ErrUnsupportedMediaType with 415,
+	// ErrBodyTooLarge with 413. Other errors are replied with status code 500
+	// without details.
+	Error(err error)
+
 	// Embedded response writer
 	http.ResponseWriter
 
@@ -68,6 +155,50 @@ func (p *Params) Set(key, value string) {
 	*p = append(*p, Param{Key: key, Value: value})
 }
 
+// RouteKind describes the kind of the route pattern
+type RouteKind int
+
+// Kinds of the routes
+const (
+	// RouteStatic is the route without parameters e.g. `/users`
+	RouteStatic RouteKind = iota
+	// RouteParam is the route with parameters e.g. `/users/:id`
+	RouteParam
+	// RouteWildcard is the route that matches the rest of the path e.g. `/static/*filepath`
+	RouteWildcard
+)
+
+var routeKinds = [...]string{"static", "param", "wildcard"}
+
+// String returns the name of the route kind
+func (k RouteKind) String() string {
+	if k < 0 || int(k) >= len(routeKinds) {
+		return "unknown"
+	}
+	return routeKinds[k]
+}
+
+// MarshalText implements encoding.TextMarshaler interface
+func (k RouteKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// RouteInfo contains information about the registered route
+type RouteInfo struct {
+	// HTTP method e.g. GET, POST
+	Method string `json:"method"`
+	// Pattern of the route e.g. `/users/:id<int>`
+	Pattern string `json:"pattern"`
+	// Name of the route registered by Named
+	Name string `json:"name,omitempty"`
+	// Keys of parameters e.g. `:id`, `*filepath`
+	Params []string `json:"params,omitempty"`
+	// Kind of the route
+	Kind RouteKind `json:"kind"`
+	// Registered handler
+	Handler func(Control) `json:"-"`
+}
+
 // Router interface contains base http methods e.g. GET, PUT, POST
 // and allows to assign user defined handlers in regular use cases
 // like `Page not found`, `Method is not allowed`,
@@ -90,6 +221,33 @@ type Router interface {
 	// PATCH registers a new request handle for HTTP PATCH method.
 	PATCH(path string, f func(Control))
 
+	// Handle registers a new request handle for the HTTP method. Unlike GET, POST, etc.
+	// it returns an error if the path is invalid or the route conflicts with already
+	// registered one (the same pattern or the parameters with other names at the same
+	// positions e.g. `/:a` and `/:b`). In this case the route is not registered.
+	Handle(method, path string, f func(Control)) error
+
+	// HandleE registers a new request handle which returns an error for the HTTP method.
+	// It works like Handle, but the error returned by the handler is passed
+	// to the error handler defined by SetupErrorHandler. The error is also
+	// available for the middleware via Control.GetError.
+	HandleE(method, path string, f func(Control) error) error
+
+	// Named registers a new request handle for the HTTP method with the name
+	// which is used to build URL of the route by URL method.
+	Named(name, method, path string, f func(Control))
+
+	// URL builds the path of the named route substituting the parameters
+	// e.g. `:id` and `*filepath`. The keys of parameters may be used without
+	// prefix e.g. `id`. It returns an error if the route is not found,
+	// the parameter is missing, empty or does not satisfy the constraint.
+	URL(name string, params ...Param) (string, error)
+
+	// Group returns a Group that registers handlers with the common path prefix.
+	// The middleware (if any) wraps only the handlers registered through the group.
+	// Groups may be nested, the prefixes and middleware are accumulated.
+	Group(prefix string, middleware ...func(func(Control)) func(Control)) Group
+
 	// Handler supports usage of the Router as a regular http Handler.
 	http.Handler
 
@@ -100,19 +258,65 @@ type Router interface {
 	// By default this option is disabled
 	UseOptionsReplies(bool)
 
+	// If enabled, the methods GET, POST, etc. panic if the path is invalid
+	// or the route conflicts with already registered one.
+	// Otherwise the invalid routes are ignored and the conflicting routes
+	// replace the registered ones. By default this option is disabled
+	UseStrictMode(bool)
+
+	// If enabled, the router redirects the request with trailing slash
+	// to the same path without it, if the route for such path exists.
+	// The status code 301 is used for GET and HEAD requests and 308 for others.
+	// By default this option is disabled
+	UseRedirectTrailingSlash(bool)
+
+	// If enabled, the router redirects the request to the canonical path:
+	// repeated slashes, `.` and `..` elements are removed, and the case of
+	// static segments is fixed if there is no route for the original case.
+	// The status code 301 is used for GET and HEAD requests and 308 for others.
+	// By default this option is disabled
+	UseRedirectFixedPath(bool)
+
 	// SetupNotAllowedHandler defines own handler which is called when a request
 	// cannot be routed.
 	SetupNotAllowedHandler(func(Control))
 
 	// SetupNotFoundHandler allows to define own handler for undefined URL path.
-	// If it is not set, http.NotFound is used.
+	// If it is not set, the problem details with status code 404 are replied.
 	SetupNotFoundHandler(func(Control))
 
 	// SetupRecoveryHandler allows to define handler that called when panic happen.
-	// The handler prevents your server from crashing and should be used to return
-	// http status code http.StatusInternalServerError (500)
+	// The handler prevents your server from crashing, e.g. it logs the panic.
+	// If the handler replies nothing, the problem details with status code
+	// http.StatusInternalServerError (500) are replied.
 	SetupRecoveryHandler(func(Control))
 
+	// SetupErrorHandler allows to define handler for the errors returned by handlers
+	// registered via HandleE. It maps the error to the status code and body of the reply.
+	// If it is not set, Control.Error is used.
+	SetupErrorHandler(func(Control, error))
+
+	// UseCompression allows to compress the replies by gzip, deflate or the codings
+	// registered by RegisterCompressor if the client accepts it in `Accept-Encoding`
+	// header. The replies of already compressed content types (images, archives, etc.)
+	// and the replies which are smaller than the size defined by SetupCompressionMinSize
+	// are not compressed. It is enabled by default.
+	UseCompression(bool)
+
+	// SetupCompressionMinSize defines the size of the reply in bytes starting
+	// from which it is compressed. By default it is 1024 bytes.
+	SetupCompressionMinSize(size int)
+
+	// SetupMaxBodySize defines the limit of the request body size in bytes
+	// which is decoded by Control.Bind. By default it is 10 MB.
+	SetupMaxBodySize(size int64)
+
+	// SetupValidator registers the validation rule by name which may be used
+	// in `validate` tags of the structs decoded by Control.Bind. The function
+	// gets the value of the field and the parameter of the rule e.g. `5`
+	// for `divisible=5`. The rule replaces the predefined one with the same name.
+	SetupValidator(name string, f func(value interface{}, param string) bool)
+
 	// SetupPresetMiddleware allows to define a middleware that take place
 	// during registration of new handlers in the Router via methods GET, POST, etc..
 	//
@@ -122,15 +326,102 @@ type Router interface {
 
 	// SetupMiddleware defines handler that is allowed to take control
 	// before it is called standard methods above e.g. GET, PUT.
+	// Every call replaces previously defined handler, use Use to compose middleware.
 	SetupMiddleware(func(func(Control)) func(Control))
 
-	// Listen and serve on requested host and port e.g "0.0.0.0:8080"
+	// Use appends middleware to the ordered chain that wraps matched handlers.
+	// The first appended middleware is called first.
+	Use(middleware ...func(func(Control)) func(Control))
+
+	// If enabled, the middleware chain defined by Use (and SetupMiddleware)
+	// is applied to the not found, not allowed and recovery handlers as well.
+	// By default this option is disabled
+	UseGlobalMiddleware(bool)
+
+	// Listen and serve on requested host and port e.g "0.0.0.0:8080",
+	// Unix domain socket e.g. "unix:/run/app.sock" or inherited file
+	// descriptor e.g. "fd:3".
 	Listen(hostPort string) error
 
+	// ListenTLS listens on requested host and port and serves HTTPS
+	// with the certificate and the matching key from the files.
+	ListenTLS(hostPort, certFile, keyFile string) error
+
+	// ListenWithOptions listens on requested address like Listen and serves
+	// the requests by the server configured with the options.
+	ListenWithOptions(hostPort string, opts ServerOptions) error
+
+	// Serve accepts connections on any listener e.g. returned by
+	// InheritedListeners and serves the requests by the server
+	// configured with the options. On the signal of ServerOptions.Signals
+	// it stops accepting new connections and drains in-flight requests.
+	// If ServerOptions.HotRestart is enabled, the listeners including
+	// the redirect listener are passed to the new process on SIGHUP
+	// or SIGUSR2 before draining.
+	// It returns nil if the server is gracefully shut down.
+	Serve(l net.Listener, opts ServerOptions) error
+
+	// Shutdown gracefully shuts down all servers started by Listen or Serve,
+	// it waits for in-flight requests until the context is done.
+	Shutdown(ctx context.Context) error
+
+	// Server returns the last server started by Listen or Serve which
+	// is serving, it is nil before the start and after the shutdown.
+	Server() *http.Server
+
+	// Routes returns information about all registered routes
+	// sorted by pattern and method.
+	Routes() []RouteInfo
+
 	// Lookup allows the manual lookup of a method + path combo.
 	// This is e.g. useful to build a framework around this router. If the path was found, it
-	// returns the handle function and the path parameter values.
-	// Otherwise the third return value indicates whether a redirection to the same path
-	// with an extra / without the trailing slash should be performed.
+	// returns the handle function, the path parameter values and true.
 	Lookup(method, path string) (func(Control), Params, bool)
+
+	// LookupRedirect returns the canonical path which the request is redirected to
+	// if UseRedirectTrailingSlash or UseRedirectFixedPath is enabled e.g. `/users/12`
+	// for `/users//12/`. It returns false if the request is not redirected.
+	LookupRedirect(method, path string) (string, bool)
+}
+
+// Group registers handlers with the common path prefix and middleware.
+// The Router is the root group, the settings of the router and the server
+// are available only through the Router.
+type Group interface {
+	// GET registers a new request handle for HTTP GET method.
+	GET(path string, f func(Control))
+	// PUT registers a new request handle for HTTP PUT method.
+	PUT(path string, f func(Control))
+	// POST registers a new request handle for HTTP POST method.
+	POST(path string, f func(Control))
+	// DELETE registers a new request handle for HTTP DELETE method.
+	DELETE(path string, f func(Control))
+	// HEAD registers a new request handle for HTTP HEAD method.
+	HEAD(path string, f func(Control))
+	// OPTIONS registers a new request handle for HTTP OPTIONS method.
+	OPTIONS(path string, f func(Control))
+	// PATCH registers a new request handle for HTTP PATCH method.
+	PATCH(path string, f func(Control))
+
+	// Handle registers a new request handle for the HTTP method like Router.Handle.
+	Handle(method, path string, f func(Control)) error
+
+	// HandleE registers a new request handle which returns an error
+	// for the HTTP method like Router.HandleE.
+	HandleE(method, path string, f func(Control) error) error
+
+	// Named registers a new request handle for the HTTP method with the name
+	// which is used to build URL of the route by Router.URL.
+	Named(name, method, path string, f func(Control))
+
+	// Group returns nested group which inherits prefix and middleware of the group.
+	Group(prefix string, middleware ...func(func(Control)) func(Control)) Group
+
+	// Use appends middleware to the ordered chain that wraps the handlers
+	// of the group. The first appended middleware is called first.
+	Use(middleware ...func(func(Control)) func(Control))
+
+	// Routes returns information about the routes with the prefix of the group
+	// sorted by pattern and method.
+	Routes() []RouteInfo
 }
@@ -0,0 +1,292 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Default size of the reply in bytes starting from which it is compressed
+const defaultCompressionMinSize = 1024
+
+// Compressor makes the writer which compresses the data written into w
+// according to the content coding that the compressor is registered for,
+// e.g. gzip.NewWriter for "gzip". The writer is closed at the end of the reply.
+type Compressor func(w io.Writer) (io.WriteCloser, error)
+
+type compressorEntry struct {
+	encoding   string
+	compressor Compressor
+}
+
+var (
+	compressorsMu sync.RWMutex
+	// Registered compressors, the order defines priority when
+	// the client accepts several encodings with the same quality
+	compressors = []compressorEntry{
+		{"gzip", newGzipWriter},
+		{"deflate", newDeflateWriter},
+	}
+)
+
+var (
+	gzipPool    sync.Pool
+	deflatePool sync.Pool
+)
+
+// RegisterCompressor registers the compressor for the content coding
+// e.g. "br", which is used for the requests which accept such coding
+// in the `Accept-Encoding` header. If the compressor for the coding
+// already exists, it is replaced.
+func RegisterCompressor(encoding string, compressor Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	encoding = strings.ToLower(encoding)
+	for idx := range compressors {
+		if compressors[idx].encoding == encoding {
+			compressors[idx].compressor = compressor
+			return
+		}
+	}
+	compressors = append(compressors, compressorEntry{encoding: encoding, compressor: compressor})
+}
+
+// negotiateEncoding selects the compressor with the highest quality
+// in the `Accept-Encoding` header, nil is returned if there is no such one.
+func negotiateEncoding(accept string) (string, Compressor) {
+	ranges := parseAccept(accept)
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	var best compressorEntry
+	var quality float64
+	for _, item := range compressors {
+		if q := acceptQuality(ranges, item.encoding); q > quality {
+			best, quality = item, q
+		}
+	}
+
+	return best.encoding, best.compressor
+}
+
+// pooledGzip returns the writer back into the pool after closing
+type pooledGzip struct {
+	*gzip.Writer
+}
+
+func (w pooledGzip) Close() error {
+	err := w.Writer.Close()
+	gzipPool.Put(w.Writer)
+	return err
+}
+
+func newGzipWriter(w io.Writer) (io.WriteCloser, error) {
+	if gz, ok := gzipPool.Get().(*gzip.Writer); ok {
+		gz.Reset(w)
+		return pooledGzip{gz}, nil
+	}
+
+	return pooledGzip{gzip.NewWriter(w)}, nil
+}
+
+// pooledDeflate returns the writer back into the pool after closing
+type pooledDeflate struct {
+	*zlib.Writer
+}
+
+func (w pooledDeflate) Close() error {
+	err := w.Writer.Close()
+	deflatePool.Put(w.Writer)
+	return err
+}
+
+// newDeflateWriter makes the writer of `deflate` coding which is
+// the zlib format according to RFC 7230
+func newDeflateWriter(w io.Writer) (io.WriteCloser, error) {
+	if zw, ok := deflatePool.Get().(*zlib.Writer); ok {
+		zw.Reset(w)
+		return pooledDeflate{zw}, nil
+	}
+
+	return pooledDeflate{zlib.NewWriter(w)}, nil
+}
+
+// compressible checks that the content type is not compressed already
+func compressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if idx := strings.IndexByte(contentType, ';'); idx >= 0 {
+		contentType = contentType[:idx]
+	}
+	contentType = strings.TrimSpace(contentType)
+	switch {
+	case contentType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(contentType, "image/"),
+		strings.HasPrefix(contentType, "video/"),
+		strings.HasPrefix(contentType, "audio/"),
+		strings.HasPrefix(contentType, "font/woff"):
+		return false
+	}
+	switch contentType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+		"application/x-xz", "application/x-7z-compressed", "application/x-rar-compressed",
+		"application/zstd", "application/wasm", "application/octet-stream":
+		return false
+	}
+
+	return true
+}
+
+// States of the compression writer
+const (
+	// the data is buffered until the minimal size is reached
+	compressPending uint8 = iota
+	// the data is written as is
+	compressSkipped
+	// the data is compressed
+	compressActive
+)
+
+// compressWriter compresses the reply if the client accepts any of registered
+// codings, the content type is not compressed already and the size of the reply
+// is not less than the minimal size. The data is buffered until the decision is made.
+type compressWriter struct {
+	http.ResponseWriter
+	// Accept-Encoding header of the request
+	accept  string
+	minSize int
+	// Status code which is postponed until the decision is made
+	code   int
+	buf    []byte
+	writer io.WriteCloser
+	state  uint8
+	// Number of bytes written before compression
+	size int64
+}
+
+// reset prepares the writer for the request
+func (w *compressWriter) reset(rw http.ResponseWriter, req *http.Request, minSize int) {
+	w.ResponseWriter, w.code, w.buf, w.writer, w.size = rw, 0, w.buf[:0], nil, 0
+	w.accept, w.minSize, w.state = "", minSize, compressSkipped
+	if req == nil || req.Method == "HEAD" {
+		return
+	}
+	if accept := req.Header.Get("Accept-Encoding"); accept != "" {
+		w.accept, w.state = accept, compressPending
+	}
+}
+
+// WriteHeader postpones the status code until the decision about compression is made
+func (w *compressWriter) WriteHeader(code int) {
+	if w.state != compressPending || code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent {
+		w.state = compressSkipped
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+}
+
+// Write compresses the data or buffers it until the minimal size is reached
+func (w *compressWriter) Write(b []byte) (int, error) {
+	n, err := w.write(b)
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *compressWriter) write(b []byte) (int, error) {
+	switch w.state {
+	case compressActive:
+		return w.writer.Write(b)
+	case compressPending:
+		if len(w.buf)+len(b) < w.minSize {
+			w.buf = append(w.buf, b...)
+			return len(b), nil
+		}
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+		return w.write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the buffered data to the client
+func (w *compressWriter) Flush() {
+	if w.state == compressPending {
+		w.start(len(w.buf) > 0)
+	}
+	if f, ok := w.writer.(interface {
+		Flush() error
+	}); ok && w.state == compressActive {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// start makes the decision about compression, writes the status code and the buffered data
+func (w *compressWriter) start(compress bool) error {
+	w.state = compressSkipped
+	header := w.Header()
+	if compress && header.Get("Content-Encoding") == "" {
+		contentType := header.Get("Content-Type")
+		if contentType == "" {
+			// detect content type before compression if it isn't defined
+			contentType = http.DetectContentType(w.buf)
+			header.Set("Content-Type", contentType)
+		}
+		if compressible(contentType) {
+			header.Add("Vary", "Accept-Encoding")
+			if encoding, compressor := negotiateEncoding(w.accept); compressor != nil {
+				if writer, err := compressor(w.ResponseWriter); err == nil {
+					header.Set("Content-Encoding", encoding)
+					header.Del("Content-Length")
+					w.writer, w.state = writer, compressActive
+				}
+			}
+		}
+	}
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = w.buf[:0]
+	_, err := w.write(buf)
+
+	return err
+}
+
+// close writes the buffered data and finishes the compressed stream,
+// the data written after that is not compressed.
+func (w *compressWriter) close() error {
+	switch w.state {
+	case compressPending:
+		if len(w.buf) > 0 || w.code != 0 {
+			return w.start(false)
+		}
+		w.state = compressSkipped
+	case compressActive:
+		w.state = compressSkipped
+		err := w.writer.Close()
+		w.writer = nil
+		return err
+	}
+
+	return nil
+}
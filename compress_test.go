@@ -0,0 +1,314 @@
+package bit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept, expected string
+	}{
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip, deflate", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"deflate;q=0.5, *", "gzip"},
+		{"gzip;q=0, *;q=0.1", "deflate"},
+		{"identity", ""},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"GZIP", "gzip"},
+	}
+	for _, test := range tests {
+		if encoding, _ := negotiateEncoding(test.accept); encoding != test.expected {
+			t.Error("Expected", test.expected, "got", encoding, "for", test.accept)
+		}
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"text/html; charset=utf-8": true,
+		"application/json":         true,
+		"image/svg+xml":            true,
+		"image/png":                false,
+		"video/mp4":                false,
+		"Application/Zip":          false,
+		"application/gzip":         false,
+		"font/woff2":               false,
+	} {
+		if result := compressible(contentType); result != expected {
+			t.Error("Expected", expected, "got", result, "for", contentType)
+		}
+	}
+}
+
+func TestRouterCompression(t *testing.T) {
+	r := getRouterForTesting()
+	r.UseCompression(true)
+	r.SetupCompressionMinSize(16)
+	large := strings.Repeat("compressible data ", 10)
+	r.GET("/write", func(c Control) {
+		c.Header().Set("Content-Length", "180")
+		c.WriteHeader(http.StatusAccepted)
+		for i := 0; i < 10; i++ {
+			c.Write([]byte("compressible data "))
+		}
+	})
+	r.GET("/small", func(c Control) {
+		c.Write([]byte("small"))
+	})
+	r.GET("/image", func(c Control) {
+		c.Header().Set("Content-Type", "image/png")
+		c.Write([]byte(large))
+	})
+	r.GET("/encoded", func(c Control) {
+		c.Header().Set("Content-Encoding", "br")
+		c.Write([]byte(large))
+	})
+	r.GET("/empty", func(c Control) {
+		c.WriteHeader(http.StatusNoContent)
+	})
+	tests := []struct {
+		path, accept, encoding, vary string
+		code                         int
+		body                         string
+	}{
+		{"/write", "gzip", "gzip", "Accept-Encoding", http.StatusAccepted, large},
+		{"/write", "deflate, gzip;q=0.5", "deflate", "Accept-Encoding", http.StatusAccepted, large},
+		{"/write", "br", "", "Accept-Encoding", http.StatusAccepted, large},
+		{"/write", "", "", "", http.StatusAccepted, large},
+		{"/small", "gzip", "", "", http.StatusOK, "small"},
+		{"/image", "gzip", "", "", http.StatusOK, large},
+		{"/encoded", "gzip", "br", "", http.StatusOK, large},
+		{"/empty", "gzip", "", "", http.StatusNoContent, ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept-Encoding", test.accept)
+		}
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, req)
+		if trw.Code != test.code {
+			t.Error("Expected", test.code, "got", trw.Code, "for", test.path, test.accept)
+		}
+		if encoding := trw.Header().Get("Content-Encoding"); encoding != test.encoding {
+			t.Error("Expected", test.encoding, "got", encoding, "for", test.path, test.accept)
+		}
+		if vary := trw.Header().Get("Vary"); vary != test.vary {
+			t.Error("Expected", test.vary, "got", vary, "for", test.path, test.accept)
+		}
+		var body io.Reader = trw.Body
+		switch test.encoding {
+		case "gzip":
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = gz
+		case "deflate":
+			zr, err := zlib.NewReader(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = zr
+		}
+		if test.encoding == "gzip" || test.encoding == "deflate" {
+			if length := trw.Header().Get("Content-Length"); length != "" {
+				t.Error("Expected empty Content-Length, got", length)
+			}
+			if contentType := trw.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+				t.Error("Expected detected content type, got", contentType)
+			}
+		}
+		content, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(content) != test.body {
+			t.Error("Expected", test.body, "got", string(content), "for", test.path, test.accept)
+		}
+	}
+	// compression is disabled
+	r.UseCompression(false)
+	req := httptest.NewRequest("GET", "/write", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if encoding := trw.Header().Get("Content-Encoding"); encoding != "" || trw.Body.String() != large {
+		t.Error("Expected uncompressed reply, got", encoding, trw.Body.String())
+	}
+}
+
+func TestCompressionHead(t *testing.T) {
+	r := NewRouter()
+	r.SetupCompressionMinSize(1)
+	r.HEAD("/", func(c Control) {
+		c.Header().Set("Content-Length", "10")
+		c.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest("HEAD", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if length := trw.Header().Get("Content-Length"); length != "10" {
+		t.Error("Expected", "10", "got", length)
+	}
+	if encoding := trw.Header().Get("Content-Encoding"); encoding != "" {
+		t.Error("Expected empty encoding, got", encoding)
+	}
+}
+
+func TestCompressionFlush(t *testing.T) {
+	r := NewRouter()
+	r.GET("/flush", func(c Control) {
+		c.Write([]byte("event: 1\n"))
+		c.(http.Flusher).Flush()
+	})
+	req := httptest.NewRequest("GET", "/flush", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if !trw.Flushed {
+		t.Error("Expected flushed reply")
+	}
+	if encoding := trw.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Error("Expected", "gzip", "got", encoding)
+	}
+	gz, err := gzip.NewReader(trw.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadAll(gz); string(content) != "event: 1\n" {
+		t.Error("Expected", "event: 1\n", "got", string(content))
+	}
+}
+
+func TestCompressionWriteAfterBody(t *testing.T) {
+	r := NewRouter()
+	r.SetupCompressionMinSize(1)
+	large := strings.Repeat("content ", 1024)
+	r.GET("/body", func(c Control) {
+		c.Body(large)
+		c.Body(large)
+		c.Write([]byte("tail"))
+	})
+	req := httptest.NewRequest("GET", "/body", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if encoding := trw.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Error("Expected", "gzip", "got", encoding)
+	}
+	gz, err := gzip.NewReader(trw.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Error("Expected nil error, got", err)
+	}
+	if expected := large + large + "tail"; string(content) != expected {
+		t.Error("Expected", len(expected), "bytes, got", len(content))
+	}
+}
+
+func TestCompressionMiddlewareWrite(t *testing.T) {
+	r := NewRouter()
+	r.Use(func(next func(Control)) func(Control) {
+		return func(c Control) {
+			next(c)
+			c.Write([]byte("FOOTER"))
+		}
+	})
+	data := strings.Repeat("a", 4000)
+	r.GET("/footer", func(c Control) {
+		c.Write([]byte(data))
+	})
+	req := httptest.NewRequest("GET", "/footer", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if encoding := trw.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Error("Expected", "gzip", "got", encoding)
+	}
+	gz, err := gzip.NewReader(trw.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Error("Expected nil error, got", err)
+	}
+	if string(content) != data+"FOOTER" {
+		t.Error("Expected", len(data)+6, "bytes, got", len(content))
+	}
+}
+
+func TestNewControlCompression(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw := httptest.NewRecorder()
+	c := NewControl(trw, req)
+	c.WriteHeader(http.StatusCreated)
+	c.Write([]byte("hello"))
+	if trw.Code != http.StatusCreated || trw.Body.String() != "hello" {
+		t.Error("Expected", http.StatusCreated, "hello", "got", trw.Code, trw.Body.String())
+	}
+	large := strings.Repeat("content ", 1024)
+	trw = httptest.NewRecorder()
+	c = NewControl(trw, req)
+	c.Body(large)
+	if encoding := trw.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Error("Expected", "gzip", "got", encoding)
+	}
+	gz, err := gzip.NewReader(trw.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadAll(gz); err != nil || string(content) != large {
+		t.Error("Expected", len(large), "bytes, got", len(content), err)
+	}
+}
+
+func TestRegisterCompressor(t *testing.T) {
+	var used bool
+	RegisterCompressor("x-test", func(w io.Writer) (io.WriteCloser, error) {
+		used = true
+		return nopWriteCloser{w}, nil
+	})
+	defer func() {
+		compressorsMu.Lock()
+		compressors = compressors[:len(compressors)-1]
+		compressorsMu.Unlock()
+	}()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0.5, x-test")
+	trw := httptest.NewRecorder()
+	data := bytes.Repeat([]byte("a"), defaultCompressionMinSize)
+	c := NewControl(trw, req)
+	c.Body(string(data))
+	if !used {
+		t.Error("Expected registered compressor is used")
+	}
+	if encoding := trw.Header().Get("Content-Encoding"); encoding != "x-test" {
+		t.Error("Expected", "x-test", "got", encoding)
+	}
+	if !bytes.Equal(trw.Body.Bytes(), data) {
+		t.Error("Expected", len(data), "bytes, got", trw.Body.Len())
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"regexp"
+	"strings"
+)
+
+// matcher checks that a path segment satisfies the parameter constraint
+type matcher func(string) bool
+
+// Predefined constraints which may be used in parameters like `:id<int>`.
+// Any other constraint is treated as a regular expression e.g. `:slug<[a-z-]+>`.
+var constraints = map[string]matcher{
+	"int":   isInt,
+	"uint":  isUint,
+	"alpha": isAlpha,
+	"alnum": isAlnum,
+	"uuid":  isUUID,
+}
+
+// parseParam splits parameter segment like `:id<int>` into the key `:id`
+// and the matcher of the constraint. If the segment has no constraint,
+// the matcher is nil. It returns false if the constraint is invalid.
+func parseParam(segment string) (string, matcher, bool) {
+	start := strings.IndexByte(segment, '<')
+	if start < 0 || segment[len(segment)-1] != '>' {
+		return segment, nil, true
+	}
+	key, expr := segment[:start], segment[start+1:len(segment)-1]
+	if key == ":" || expr == "" {
+		return segment, nil, false
+	}
+	if m, ok := constraints[expr]; ok {
+		return key, m, true
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return segment, nil, false
+	}
+
+	return key, re.MatchString, true
+}
+
+func isInt(s string) bool {
+	if len(s) > 1 && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+
+	return isUint(s)
+}
+
+func isUint(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isAlpha(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 'a' || s[i] > 'z') && (s[i] < 'A' || s[i] > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isAlnum(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isAlpha(s[i:i+1]) && !isUint(s[i:i+1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// isUUID checks canonical textual representation of UUID e.g.
+// `123e4567-e89b-12d3-a456-426655440000`
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
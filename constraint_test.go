@@ -0,0 +1,63 @@
+package bit
+
+import "testing"
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		segment, key string
+		constrained  bool
+		ok           bool
+	}{
+		{":id", ":id", false, true},
+		{":id<int>", ":id", true, true},
+		{":slug<[a-z-]+>", ":slug", true, true},
+		{":bad<[a-z>", ":bad<[a-z>", false, false},
+		{":<int>", ":<int>", false, false},
+		{":empty<>", ":empty<>", false, false},
+	}
+	for _, test := range tests {
+		key, m, ok := parseParam(test.segment)
+		if ok != test.ok {
+			t.Error("Expected", test.ok, "got", ok, "for", test.segment)
+		}
+		if key != test.key {
+			t.Error("Expected", test.key, "got", key, "for", test.segment)
+		}
+		if (m != nil) != test.constrained {
+			t.Error("Expected constraint", test.constrained, "for", test.segment)
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	tests := []struct {
+		constraint string
+		valid      []string
+		invalid    []string
+	}{
+		{"int", []string{"0", "12", "-7", "+3"}, []string{"", "-", "1a", "1.5"}},
+		{"uint", []string{"0", "12"}, []string{"", "-7", "x"}},
+		{"alpha", []string{"abc", "ABc"}, []string{"", "ab1", "a-b"}},
+		{"alnum", []string{"abc", "a1B2"}, []string{"", "a-1", "a_b"}},
+		{"uuid", []string{"123e4567-e89b-12d3-a456-426655440000"}, []string{
+			"", "123e4567e89b12d3a456426655440000", "123e4567-e89b-12d3-a456-42665544000g",
+		}},
+		{"[a-z]+-[0-9]", []string{"abc-1"}, []string{"abc-12", "xabc-1x", "ABC-1"}},
+	}
+	for _, test := range tests {
+		_, m, ok := parseParam(":p<" + test.constraint + ">")
+		if !ok || m == nil {
+			t.Fatal("Expected valid constraint", test.constraint)
+		}
+		for _, value := range test.valid {
+			if !m(value) {
+				t.Error("Expected", value, "matches", test.constraint)
+			}
+		}
+		for _, value := range test.invalid {
+			if m(value) {
+				t.Error("Expected", value, "does not match", test.constraint)
+			}
+		}
+	}
+}
@@ -5,8 +5,8 @@
 package bit
 
 import (
-	"compress/gzip"
-	"encoding/json"
+	"context"
+	"crypto/x509"
 	"net/http"
 	"strings"
 )
@@ -16,16 +16,57 @@ type control struct {
 	w      http.ResponseWriter
 	code   int
 	params *Params
+	// Router which handles the request, it is nil for NewControl
+	router *router
+	// Error returned by the handler or replied by Error
+	err error
+	// Pattern of the matched route e.g. `/users/:id`
+	route string
+	// Writer which compresses the reply, it is used as w if compression is enabled
+	cw compressWriter
+	// Writer which records the status code and size of the reply
+	tw tracker
+	// Values stored by Set, the map is allocated on the first use
+	store map[string]interface{}
 }
 
 // NewControl returns new control that implement Control interface.
+// The data written by Body or Error is compressed if the client accepts it,
+// the data written directly is not buffered and is not compressed.
 func NewControl(w http.ResponseWriter, req *http.Request) Control {
 	params := make(Params, 0)
-	return &control{
+	c := &control{
 		req:    req,
-		w:      w,
 		params: &params,
 	}
+	c.tw.reset(w)
+	c.w = &c.tw
+
+	return c
+}
+
+// finish writes the rest of the reply if it is compressed
+func (c *control) finish() {
+	if c.w == &c.cw {
+		c.cw.close()
+	}
+}
+
+// reply writes the status code (if any) and the content. The router compresses
+// the reply until the end of the request, so the handler and the middleware may
+// write more data after that. The control made by NewControl has no end of
+// the request, so only the content is compressed.
+func (c *control) reply(code int, content []byte) {
+	w := c.w
+	if c.router == nil {
+		c.cw.reset(&c.tw, c.req, defaultCompressionMinSize)
+		w = &c.cw
+		defer c.cw.close()
+	}
+	if code > 0 {
+		w.WriteHeader(code)
+	}
+	w.Write(content)
 }
 
 // Request returns *http.Request
@@ -33,6 +74,30 @@ func (c *control) Request() *http.Request {
 	return c.req
 }
 
+// SetRequest replaces the request, e.g. by the request with updated context
+func (c *control) SetRequest(req *http.Request) {
+	c.req = req
+}
+
+// Context returns the context of the request
+func (c *control) Context() context.Context {
+	return c.req.Context()
+}
+
+// Set stores the value by the key for the time of the request
+func (c *control) Set(key string, value interface{}) {
+	if c.store == nil {
+		c.store = make(map[string]interface{})
+	}
+	c.store[key] = value
+}
+
+// Get returns the value stored by Set and whether it is present
+func (c *control) Get(key string) (interface{}, bool) {
+	value, ok := c.store[key]
+	return value, ok
+}
+
 // Response writer implementation
 // Header represents http.ResponseWriter header, the key-value pairs in an HTTP header.
 func (c *control) Header() http.Header {
@@ -49,6 +114,13 @@ func (c *control) WriteHeader(code int) {
 	c.w.WriteHeader(code)
 }
 
+// Flush sends any buffered data to the client, it implements http.Flusher
+func (c *control) Flush() {
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // Params get embedded key/value data that contains URL/Post query parameters
 func (c *control) Params() *Params {
 	return c.params
@@ -76,42 +148,74 @@ func (c *control) GetCode() int {
 	return c.code
 }
 
+// Route returns the pattern of the matched route, it is empty if the route is not found
+func (c *control) Route() string {
+	return c.route
+}
+
+// ClientCertificate returns the certificate presented by the client over TLS
+func (c *control) ClientCertificate() *x509.Certificate {
+	if c.req.TLS == nil || len(c.req.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return c.req.TLS.PeerCertificates[0]
+}
+
+// GetError returns the error returned by the handler or replied by Error
+func (c *control) GetError() error {
+	return c.err
+}
+
+// setError keeps the error returned by the handler
+func (c *control) setError(err error) {
+	c.err = err
+}
+
 // Body writes prepared header, status code and body data into http output.
 // It is equal to using sequence of http.ResponseWriter methods:
 // WriteHeader(code int) and Write(b []byte) int, error
+// The string data is written as is, other data is encoded by the encoder
+// registered for the media type accepted by the client, JSON by default.
+// If the encoder fails, the next acceptable one is used.
+// ValidationErrors are replied with status code 422 unless other code is set.
 func (c *control) Body(data interface{}) {
 	var content []byte
 
+	if _, ok := data.(ValidationErrors); ok && c.code == 0 {
+		c.code = http.StatusUnprocessableEntity
+	}
 	if str, ok := data.(string); ok {
 		content = []byte(str)
 	} else {
+		c.w.Header().Add("Vary", "Accept")
+		var mediaType string
 		var err error
-		content, err = json.Marshal(data)
-		if err != nil {
-			c.w.WriteHeader(http.StatusInternalServerError)
-			c.w.Write([]byte(err.Error()))
+		for _, entry := range negotiate(c.req.Header.Get("Accept")) {
+			// the next acceptable encoder is used if the data cannot be encoded
+			encoded, e := entry.encoder(data)
+			if e == nil {
+				mediaType, content = entry.mediaType, encoded
+				break
+			}
+			if err == nil && e != errNotText {
+				err = e
+			}
+		}
+		if mediaType == "" {
+			if err != nil {
+				c.Error(err)
+			} else {
+				c.Error(NewProblem(http.StatusNotAcceptable, ""))
+			}
 			return
 		}
 		if c.w.Header().Get("Content-type") == "" {
-			c.w.Header().Add("Content-type", "application/json")
-		}
-	}
-	if strings.Contains(c.req.Header.Get("Accept-Encoding"), "gzip") {
-		// Detect content type before encoding if it isn't defined
-		if c.w.Header().Get("Content-type") == "" {
-			c.w.Header().Set("Content-type", http.DetectContentType(content))
-		}
-		c.w.Header().Add("Content-Encoding", "gzip")
-		if c.code > 0 {
-			c.w.WriteHeader(c.code)
-		}
-		gz := gzip.NewWriter(c.w)
-		gz.Write(content)
-		gz.Close()
-	} else {
-		if c.code > 0 {
-			c.w.WriteHeader(c.code)
+			if strings.HasPrefix(mediaType, "text/") {
+				mediaType += "; charset=utf-8"
+			}
+			c.w.Header().Add("Content-type", mediaType)
 		}
-		c.w.Write(content)
 	}
+	c.reply(c.code, content)
 }
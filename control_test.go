@@ -1,8 +1,13 @@
 package bit
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 )
 
@@ -23,17 +28,7 @@ var params2 = []prm{
 }
 
 var testParamsData = `[{"Key":"name","Value":"John"},{"Key":"age","Value":"32"},{"Key":"gender","Value":"M"}]`
-var testParamGzipData = []byte{
-	31, 139, 8, 0, 0, 0, 0, 0, 0, 255, 138, 174, 86, 242, 78, 173, 84, 178, 82, 202,
-	75, 204, 77, 85, 210, 81, 10, 75, 204, 41, 77, 85, 178, 82, 242, 202, 207, 200,
-	83, 170, 213, 129, 201, 38, 166, 35, 75, 26, 27, 33, 73, 165, 167, 230, 165, 164,
-	22, 33, 201, 250, 42, 213, 198, 2, 2, 0, 0, 255, 255, 196, 73, 247, 37, 87, 0, 0, 0,
-}
 var testStrData = "plain text"
-var testStrGzipData = []byte{
-	31, 139, 8, 0, 0, 0, 0, 0, 0, 255, 42, 200, 73, 204, 204, 83, 40,
-	73, 173, 40, 1, 4, 0, 0, 255, 255, 184, 15, 11, 68, 10, 0, 0, 0,
-}
 
 func TestParamsQueryGet(t *testing.T) {
 
@@ -149,35 +144,51 @@ func TestWrite(t *testing.T) {
 		t.Error("Expected", expected, "got", contentType)
 	}
 
-	// Write encoded string
+	// Small data is not encoded
 	req.Header.Add("Accept-Encoding", "gzip, deflate")
 	trw = httptest.NewRecorder()
 	c = NewControl(trw, req)
 	c.Code(http.StatusAccepted)
 	c.Body(testStrData)
-	if trw.Body.String() != string(testStrGzipData) {
-		t.Error("Expected", testStrGzipData, "got", trw.Body)
+	if trw.Code != http.StatusAccepted {
+		t.Error("Expected", http.StatusAccepted, "got", trw.Code)
 	}
-	contentEncoding := trw.Header().Get("Content-Encoding")
-	expected = "gzip"
-	if contentEncoding != expected {
-		t.Error("Expected", expected, "got", contentEncoding)
+	if trw.Body.String() != testStrData {
+		t.Error("Expected", testStrData, "got", trw.Body)
+	}
+	if contentEncoding := trw.Header().Get("Content-Encoding"); contentEncoding != "" {
+		t.Error("Expected empty encoding, got", contentEncoding)
 	}
 
 	// Write encoded struct data
-	req.Header.Add("Accept-Encoding", "gzip, deflate")
+	var data []prm
+	for len(data) < 100 {
+		data = append(data, params1...)
+	}
 	trw = httptest.NewRecorder()
 	c = NewControl(trw, req)
 	c.Code(http.StatusAccepted)
-	c.Body(params1)
-	if trw.Body.String() != string(testParamGzipData) {
-		t.Error("Expected", testParamGzipData, "got", trw.Body)
+	c.Body(data)
+	if trw.Code != http.StatusAccepted {
+		t.Error("Expected", http.StatusAccepted, "got", trw.Code)
 	}
-	contentEncoding = trw.Header().Get("Content-Encoding")
+	contentEncoding := trw.Header().Get("Content-Encoding")
 	expected = "gzip"
 	if contentEncoding != expected {
 		t.Error("Expected", expected, "got", contentEncoding)
 	}
+	gz, err := gzip.NewReader(trw.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Error(err)
+	}
+	var decoded []prm
+	if err := json.Unmarshal(content, &decoded); err != nil || !reflect.DeepEqual(decoded, data) {
+		t.Error("Expected decoded data, got", string(content), err)
+	}
 
 	// Try to write unexpected data type
 	trw = httptest.NewRecorder()
@@ -191,3 +202,41 @@ func TestWrite(t *testing.T) {
 		t.Error("Expected", expected, "got", contentType)
 	}
 }
+
+func TestControlContext(t *testing.T) {
+	type ctxKey struct{}
+	r := getRouterForTesting()
+	r.Use(func(next func(Control)) func(Control) {
+		return func(c Control) {
+			if _, ok := c.Get("user"); ok {
+				t.Error("Expected values of the previous request are cleared")
+			}
+			c.Set("user", "john")
+			ctx := context.WithValue(c.Context(), ctxKey{}, "trace")
+			c.SetRequest(c.Request().WithContext(ctx))
+			next(c)
+		}
+	})
+	r.GET("/users/:name", func(c Control) {
+		if value, ok := c.Get("user"); !ok || value != "john" {
+			t.Error("Expected", "john", "got", value, ok)
+		}
+		if value := c.Context().Value(ctxKey{}); value != "trace" {
+			t.Error("Expected", "trace", "got", value)
+		}
+		if c.Request().Context() != c.Context() {
+			t.Error("Expected context of the replaced request")
+		}
+		if _, ok := c.Get("unknown"); ok {
+			t.Error("Expected absent value for unknown key")
+		}
+		c.Body("Hello " + c.Query(":name"))
+	})
+	for i := 0; i < 2; i++ {
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, httptest.NewRequest("GET", "/users/john", nil))
+		if trw.Body.String() != "Hello john" {
+			t.Error("Expected", "Hello john", "got", trw.Body.String())
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder converts data into representation of the media type
+// that the encoder is registered for, e.g. json.Marshal for "application/json".
+type Encoder func(data interface{}) ([]byte, error)
+
+type encoderEntry struct {
+	mediaType string
+	encoder   Encoder
+}
+
+var (
+	encodersMu sync.RWMutex
+	// Registered encoders, the order defines priority when
+	// the client accepts several media types with the same quality
+	encoders = []encoderEntry{
+		{"application/json", json.Marshal},
+		{"application/xml", xml.Marshal},
+		{"text/xml", xml.Marshal},
+		{"application/msgpack", marshalMsgpack},
+		{"application/x-msgpack", marshalMsgpack},
+		{"text/plain", marshalText},
+	}
+)
+
+// RegisterEncoder registers the encoder for the media type that is used by
+// Control.Body for the requests which accept such media type. If the encoder
+// for the media type already exists, it is replaced.
+func RegisterEncoder(mediaType string, encoder Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	mediaType = strings.ToLower(mediaType)
+	for idx := range encoders {
+		if encoders[idx].mediaType == mediaType {
+			encoders[idx].encoder = encoder
+			return
+		}
+	}
+	encoders = append(encoders, encoderEntry{mediaType: mediaType, encoder: encoder})
+}
+
+// errNotText is returned by the text encoder for the data which has no text representation
+var errNotText = errors.New("data has no text representation")
+
+// negotiate returns the encoders acceptable by the Accept header sorted by quality,
+// the encoders with the same quality keep the order of registration, so the next
+// encoder may be used if the previous one cannot encode the data.
+// If the header is empty, all registered encoders are acceptable.
+func negotiate(accept string) []encoderEntry {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	if strings.TrimSpace(accept) == "" {
+		return append([]encoderEntry(nil), encoders...)
+	}
+	ranges := parseAccept(accept)
+	var result []encoderEntry
+	var qualities []float64
+	for _, item := range encoders {
+		if q := acceptQuality(ranges, item.mediaType); q > 0 {
+			result, qualities = append(result, item), append(qualities, q)
+		}
+	}
+	sort.Stable(byQuality{result, qualities})
+
+	return result
+}
+
+// byQuality sorts the encoders by quality in descending order
+type byQuality struct {
+	entries   []encoderEntry
+	qualities []float64
+}
+
+func (b byQuality) Len() int {
+	return len(b.entries)
+}
+
+func (b byQuality) Less(i, j int) bool {
+	return b.qualities[i] > b.qualities[j]
+}
+
+func (b byQuality) Swap(i, j int) {
+	b.entries[i], b.entries[j] = b.entries[j], b.entries[i]
+	b.qualities[i], b.qualities[j] = b.qualities[j], b.qualities[i]
+}
+
+// accepted is an element of Accept-like header e.g. `text/html;q=0.8`
+type accepted struct {
+	value   string
+	quality float64
+}
+
+// parseAccept parses Accept-like header into the list of values
+// sorted by quality, the more specific values go first for equal quality.
+func parseAccept(header string) []accepted {
+	var result []accepted
+	for _, item := range strings.Split(header, ",") {
+		params := strings.Split(item, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		a := accepted{value: value, quality: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && (param[0] == 'q' || param[0] == 'Q') && param[1] == '=' {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q >= 0 && q <= 1 {
+					a.quality = q
+				}
+			}
+		}
+		result = append(result, a)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].quality == result[j].quality {
+			return specificity(result[i].value) > specificity(result[j].value)
+		}
+		return result[i].quality > result[j].quality
+	})
+
+	return result
+}
+
+// specificity returns 0 for `*/*` or `*`, 1 for `type/*` and 2 for others
+func specificity(value string) int {
+	switch {
+	case value == "*/*" || value == "*":
+		return 0
+	case strings.HasSuffix(value, "/*"):
+		return 1
+	}
+
+	return 2
+}
+
+// acceptQuality returns quality of the most specific value that matches the media type
+func acceptQuality(ranges []accepted, mediaType string) float64 {
+	quality, level := 0.0, -1
+	for _, item := range ranges {
+		matched := item.value == mediaType || item.value == "*/*" || item.value == "*" ||
+			(strings.HasSuffix(item.value, "/*") && strings.HasPrefix(mediaType, item.value[:len(item.value)-1]))
+		if matched && specificity(item.value) > level {
+			quality, level = item.quality, specificity(item.value)
+		}
+	}
+
+	return quality
+}
+
+// marshalText represents strings, Stringers and errors as plain text,
+// other data has no text representation
+func marshalText(data interface{}) ([]byte, error) {
+	switch value := data.(type) {
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	case fmt.Stringer:
+		return []byte(value.String()), nil
+	case error:
+		return []byte(value.Error()), nil
+	}
+
+	return nil, errNotText
+}
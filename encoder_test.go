@@ -0,0 +1,162 @@
+package bit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	result := parseAccept("text/*;q=0.5, application/json, */*;q=0.1, text/html;level=1;q=0.5, ,image/png;q=x")
+	expected := []accepted{
+		{"application/json", 1},
+		{"image/png", 1},
+		{"text/html", 0.5},
+		{"text/*", 0.5},
+		{"*/*", 0.1},
+	}
+	if len(result) != len(expected) {
+		t.Fatal("Expected", expected, "got", result)
+	}
+	for idx := range expected {
+		if result[idx] != expected[idx] {
+			t.Error("Expected", expected[idx], "got", result[idx])
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept, mediaType string
+		ok                bool
+	}{
+		{"", "application/json", true},
+		{"*/*", "application/json", true},
+		{"application/xml", "application/xml", true},
+		{"application/xml;q=0.9, application/json", "application/json", true},
+		{"*/*, application/json;q=0", "application/xml", true},
+		{"text/*", "text/xml", true},
+		{"text/*, text/xml;q=0.5", "text/plain", true},
+		{"application/x-msgpack", "application/x-msgpack", true},
+		{"image/png", "", false},
+	}
+	for _, test := range tests {
+		entries := negotiate(test.accept)
+		if ok := len(entries) > 0; ok != test.ok {
+			t.Error("Expected", test.ok, "got", ok, "for", test.accept)
+		}
+		if len(entries) > 0 && entries[0].mediaType != test.mediaType {
+			t.Error("Expected", test.mediaType, "got", entries[0].mediaType, "for", test.accept)
+		}
+	}
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	expected := []string{"application/xml", "application/json", "text/xml"}
+	entries := negotiate(browser)
+	for idx := range expected {
+		if entries[idx].mediaType != expected[idx] {
+			t.Error("Expected", expected[idx], "got", entries[idx].mediaType, "at", idx)
+		}
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	RegisterEncoder("Application/Vnd.Test", func(data interface{}) ([]byte, error) {
+		return []byte("test"), nil
+	})
+	defer func() {
+		encodersMu.Lock()
+		encoders = encoders[:len(encoders)-1]
+		encodersMu.Unlock()
+	}()
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.Header.Set("Accept", "application/vnd.test")
+	trw := httptest.NewRecorder()
+	NewControl(trw, req).Body(params1)
+	if trw.Body.String() != "test" {
+		t.Error("Expected", "test", "got", trw.Body.String())
+	}
+	if contentType := trw.Header().Get("Content-Type"); contentType != "application/vnd.test" {
+		t.Error("Expected", "application/vnd.test", "got", contentType)
+	}
+}
+
+func TestBodyNegotiation(t *testing.T) {
+	type user struct {
+		Name string `json:"name" xml:"name"`
+		Age  int    `json:"age" xml:"age"`
+	}
+	data := user{Name: "John", Age: 32}
+	tests := []struct {
+		accept, contentType, body string
+		code                      int
+	}{
+		{"", "application/json", `{"name":"John","age":32}`, http.StatusOK},
+		{"application/xml", "application/xml", `<user><name>John</name><age>32</age></user>`, http.StatusOK},
+		{"application/msgpack", "application/msgpack", "\x82\xa4name\xa4John\xa3age\x20", http.StatusOK},
+		{"text/plain", "application/problem+json", `{"status":406,"title":"Not Acceptable","type":"about:blank"}`,
+			http.StatusNotAcceptable},
+		{"image/png", "application/problem+json", `{"status":406,"title":"Not Acceptable","type":"about:blank"}`,
+			http.StatusNotAcceptable},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		trw := httptest.NewRecorder()
+		NewControl(trw, req).Body(data)
+		if trw.Code != test.code {
+			t.Error("Expected", test.code, "got", trw.Code, "for", test.accept)
+		}
+		if trw.Body.String() != test.body {
+			t.Errorf("Expected %q got %q", test.body, trw.Body.String())
+		}
+		if contentType := trw.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Error("Expected", test.contentType, "got", contentType)
+		}
+		if vary := trw.Header().Get("Vary"); vary != "Accept" {
+			t.Error("Expected", "Accept", "got", vary)
+		}
+	}
+}
+
+func TestBodyEncoderFallback(t *testing.T) {
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	tests := []struct {
+		accept      string
+		data        interface{}
+		contentType string
+		body        string
+		code        int
+	}{
+		// XML cannot encode maps, JSON is accepted by */*
+		{browser, map[string]string{"name": "John"}, "application/json", `{"name":"John"}`, http.StatusOK},
+		{"text/plain", NewProblem(http.StatusConflict, ""), "text/plain; charset=utf-8", "Conflict", http.StatusOK},
+		{"text/plain", []byte("raw"), "text/plain; charset=utf-8", "raw", http.StatusOK},
+		{"text/plain", &params1, "application/problem+json",
+			`{"status":406,"title":"Not Acceptable","type":"about:blank"}`, http.StatusNotAcceptable},
+		{"application/xml", map[string]string{"name": "John"}, "application/problem+json",
+			`{"status":500,"title":"Internal Server Error","type":"about:blank"}`, http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", test.accept)
+		trw := httptest.NewRecorder()
+		NewControl(trw, req).Body(test.data)
+		if trw.Code != test.code {
+			t.Error("Expected", test.code, "got", trw.Code, "for", test.accept)
+		}
+		if trw.Body.String() != test.body {
+			t.Errorf("Expected %q got %q", test.body, trw.Body.String())
+		}
+		if contentType := trw.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Error("Expected", test.contentType, "got", contentType)
+		}
+	}
+}
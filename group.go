@@ -0,0 +1,179 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import "strings"
+
+// group registers handlers of the router with the common path prefix and middleware.
+type group struct {
+	// The router which contains handlers of the group
+	router *router
+
+	// The parent group, its middleware is called before the group middleware
+	parent *group
+
+	// Path prefix that is prepended to every path of the group
+	prefix string
+
+	// List of middleware that wraps handlers of the group
+	middleware []func(func(Control)) func(Control)
+
+	// Handlers of the group routes which are rebuilt when the middleware is changed
+	handlers []*groupHandler
+
+	// Nested groups which inherit the middleware of the group
+	children []*group
+}
+
+// groupHandler calls the handler of the group route wrapped by the group middleware
+type groupHandler struct {
+	f     func(Control)
+	chain func(Control)
+}
+
+func (h *groupHandler) serve(c Control) {
+	h.chain(c)
+}
+
+// GET registers a new request handle for HTTP GET method.
+func (g *group) GET(path string, f func(Control)) {
+	g.register("GET", path, f)
+}
+
+// PUT registers a new request handle for HTTP PUT method.
+func (g *group) PUT(path string, f func(Control)) {
+	g.register("PUT", path, f)
+}
+
+// POST registers a new request handle for HTTP POST method.
+func (g *group) POST(path string, f func(Control)) {
+	g.register("POST", path, f)
+}
+
+// DELETE registers a new request handle for HTTP DELETE method.
+func (g *group) DELETE(path string, f func(Control)) {
+	g.register("DELETE", path, f)
+}
+
+// HEAD registers a new request handle for HTTP HEAD method.
+func (g *group) HEAD(path string, f func(Control)) {
+	g.register("HEAD", path, f)
+}
+
+// OPTIONS registers a new request handle for HTTP OPTIONS method.
+func (g *group) OPTIONS(path string, f func(Control)) {
+	g.register("OPTIONS", path, f)
+}
+
+// PATCH registers a new request handle for HTTP PATCH method.
+func (g *group) PATCH(path string, f func(Control)) {
+	g.register("PATCH", path, f)
+}
+
+// Handle registers a new request handle for the HTTP method. It returns an error
+// if the path is invalid or the route conflicts with already registered one.
+func (g *group) Handle(method, path string, f func(Control)) error {
+	return g.router.add("", method, concat(g.prefix, path), g.handler(f), false)
+}
+
+// HandleE registers a new request handle which returns an error for the HTTP method.
+// The error is passed to the error handler defined by SetupErrorHandler.
+func (g *group) HandleE(method, path string, f func(Control) error) error {
+	return g.Handle(method, path, g.router.handleError(f))
+}
+
+// Named registers a new request handle for the HTTP method with the name
+// which is used to build URL of the route.
+func (g *group) Named(name, method, path string, f func(Control)) {
+	g.registerNamed(name, method, path, f)
+}
+
+// Group returns nested group which inherits prefix and middleware of the group.
+func (g *group) Group(prefix string, middleware ...func(func(Control)) func(Control)) Group {
+	child := &group{
+		router:     g.router,
+		parent:     g,
+		prefix:     concat(g.prefix, prefix),
+		middleware: middleware,
+	}
+	g.children = append(g.children, child)
+
+	return child
+}
+
+// Use appends middleware to the chain that wraps handlers of the group.
+func (g *group) Use(middleware ...func(func(Control)) func(Control)) {
+	g.middleware = append(g.middleware, middleware...)
+	g.rebuild()
+}
+
+// Routes returns information about the routes registered with the prefix of the group
+func (g *group) Routes() []RouteInfo {
+	prefix := concat(g.prefix, "")
+	var routes []RouteInfo
+	for _, route := range g.router.Routes() {
+		if prefix == "/" || route.Pattern == prefix || strings.HasPrefix(route.Pattern, prefix+"/") {
+			routes = append(routes, route)
+		}
+	}
+
+	return routes
+}
+
+// registers a new handler with the prefixed path. The handler is wrapped by
+// the group middleware which may be changed later.
+func (g *group) register(method, path string, f func(Control)) {
+	g.registerNamed("", method, path, f)
+}
+
+// registers a new handler like register and saves the route with the name
+func (g *group) registerNamed(name, method, path string, f func(Control)) {
+	g.router.registerNamed(name, method, concat(g.prefix, path), g.handler(f))
+}
+
+// handler returns the handler which is wrapped by the group middleware
+func (g *group) handler(f func(Control)) func(Control) {
+	h := &groupHandler{f: f}
+	h.chain = g.wrap(h.f)
+	g.handlers = append(g.handlers, h)
+
+	return h.serve
+}
+
+// rebuild wraps the handlers of the group and the nested groups by the changed middleware
+func (g *group) rebuild() {
+	for _, h := range g.handlers {
+		h.chain = g.wrap(h.f)
+	}
+	for _, child := range g.children {
+		child.rebuild()
+	}
+}
+
+// wraps handler by the group middleware and the middleware of the parent groups.
+func (g *group) wrap(f func(Control)) func(Control) {
+	for i := len(g.middleware) - 1; i >= 0; i-- {
+		f = g.middleware[i](f)
+	}
+	if g.parent != nil {
+		return g.parent.wrap(f)
+	}
+
+	return f
+}
+
+// concat joins prefix and path into a single path with one slash between them.
+func concat(prefix, path string) string {
+	prefix = trim(trim(prefix, " "), "/")
+	path = trim(trim(path, " "), "/")
+	switch {
+	case prefix == "":
+		return "/" + path
+	case path == "":
+		return "/" + prefix
+	}
+
+	return "/" + prefix + "/" + path
+}
@@ -0,0 +1,185 @@
+package bit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroupPrefix(t *testing.T) {
+	r := getRouterForTesting()
+	api := r.Group("/api/v1/")
+	api.GET("/users/:id", func(c Control) {
+		c.Body("User " + c.Query(":id"))
+	})
+	api.POST("users", func(c Control) {
+		c.Code(http.StatusCreated)
+		c.Body("Created")
+	})
+	api.Group("admin").DELETE("/", func(c Control) {
+		c.Code(http.StatusAccepted)
+		c.Body("Deleted")
+	})
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/api/v1/users/12", http.StatusOK, "User 12"},
+		{"POST", "/api/v1/users", http.StatusCreated, "Created"},
+		{"DELETE", "/api/v1/admin", http.StatusAccepted, "Deleted"},
+		{"GET", "/users/12", http.StatusNotFound, `{"status":404,"title":"Not Found","type":"about:blank"}`},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, req)
+		if trw.Code != test.code {
+			t.Error("Expected", test.code, "got", trw.Code, "for", test.method, test.path)
+		}
+		if trw.Body.String() != test.body {
+			t.Error("Expected", test.body, "got", trw.Body.String())
+		}
+	}
+}
+
+func TestGroupMiddleware(t *testing.T) {
+	r := getRouterForTesting()
+	trace := func(name string) func(func(Control)) func(Control) {
+		return func(f func(Control)) func(Control) {
+			return func(c Control) {
+				c.Header().Add("Trace", name)
+				f(c)
+			}
+		}
+	}
+	r.GET("/public", func(c Control) {})
+	api := r.Group("/api", trace("api"))
+	api.GET("/info", func(c Control) {})
+	api.Group("/v1", trace("v1"), trace("auth")).GET("/users", func(c Control) {})
+	tests := []struct {
+		path  string
+		trace []string
+	}{
+		{"/public", nil},
+		{"/api/info", []string{"api"}},
+		{"/api/v1/users", []string{"api", "v1", "auth"}},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, req)
+		result := trw.Header()["Trace"]
+		if len(result) != len(test.trace) {
+			t.Fatal("Expected", test.trace, "got", result, "for", test.path)
+		}
+		for idx := range result {
+			if result[idx] != test.trace[idx] {
+				t.Error("Expected", test.trace, "got", result, "for", test.path)
+			}
+		}
+	}
+}
+
+func TestConcat(t *testing.T) {
+	tests := []struct {
+		prefix, path, expected string
+	}{
+		{"", "", "/"},
+		{"/", "/", "/"},
+		{"/api", "", "/api"},
+		{"api/", "/users/", "/api/users"},
+		{"/api/v1", ":id", "/api/v1/:id"},
+		{"/static", "*", "/static/*"},
+	}
+	for _, test := range tests {
+		if result := concat(test.prefix, test.path); result != test.expected {
+			t.Error("Expected", test.expected, "got", result)
+		}
+	}
+}
+
+func TestGroupUse(t *testing.T) {
+	r := getRouterForTesting()
+	api := r.Group("/api")
+	api.GET("/users", func(c Control) {})
+	r.GET("/public", func(c Control) {})
+	// middleware is applied to handlers that registered before
+	api.Use(func(f func(Control)) func(Control) {
+		return func(c Control) {
+			c.Header().Set("Group", "api")
+			f(c)
+		}
+	})
+	for path, expected := range map[string]string{"/api/users": "api", "/public": ""} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, req)
+		if result := trw.Header().Get("Group"); result != expected {
+			t.Error("Expected", expected, "got", result, "for", path)
+		}
+	}
+}
+
+func TestGroupHandleE(t *testing.T) {
+	r := getRouterForTesting()
+	r.SetupErrorHandler(func(c Control, err error) {
+		c.Code(http.StatusTeapot)
+		c.Body(err.Error())
+	})
+	api := r.Group("/api", func(f func(Control)) func(Control) {
+		return func(c Control) {
+			c.Header().Set("Group", "api")
+			f(c)
+		}
+	})
+	api.HandleE("GET", "/fail", func(c Control) error {
+		return NewProblem(http.StatusConflict, "")
+	})
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, httptest.NewRequest("GET", "/api/fail", nil))
+	if trw.Code != http.StatusTeapot || trw.Body.String() != "Conflict" {
+		t.Error("Expected", http.StatusTeapot, "Conflict", "got", trw.Code, trw.Body.String())
+	}
+	if result := trw.Header().Get("Group"); result != "api" {
+		t.Error("Expected", "api", "got", result)
+	}
+}
+
+func TestGroupRoutes(t *testing.T) {
+	r := getRouterForTesting()
+	h := func(c Control) {}
+	r.GET("/apis", h)
+	r.GET("/public", h)
+	api := r.Group("/api")
+	api.GET("/", h)
+	api.GET("/users/:id", h)
+	api.Group("/v1").POST("/items", h)
+	expected := []string{"/api", "/api/users/:id", "/api/v1/items"}
+	routes := api.Routes()
+	if len(routes) != len(expected) {
+		t.Fatal("Expected", expected, "got", routes)
+	}
+	for idx, route := range routes {
+		if route.Pattern != expected[idx] {
+			t.Error("Expected", expected[idx], "got", route.Pattern)
+		}
+	}
+	if len(r.Group("/").Routes()) != len(r.Routes()) {
+		t.Error("Expected all routes for the root group")
+	}
+	// the router is the root group
+	var root Group = r
+	if len(root.Group("/api").Routes()) != len(expected) {
+		t.Error("Expected the group of the router as Group")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Prefixes of the addresses of Unix domain sockets and inherited file descriptors
+const (
+	unixPrefix = "unix:"
+	fdPrefix   = "fd:"
+)
+
+// The first file descriptor passed by socket activation (SD_LISTEN_FDS_START)
+const listenFdsStart = 3
+
+// ErrInvalidListenFds is returned if the environment of socket activation is malformed
+var ErrInvalidListenFds = errors.New("invalid LISTEN_FDS environment")
+
+// listen returns the listener for the address which may be TCP host and port
+// e.g. `:8080`, Unix domain socket e.g. `unix:/run/app.sock` or inherited
+// file descriptor e.g. `fd:3`
+func listen(address string, opts ServerOptions) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(address, unixPrefix):
+		return listenUnix(strings.TrimPrefix(address, unixPrefix), opts.SocketMode)
+	case strings.HasPrefix(address, fdPrefix):
+		fd, err := strconv.Atoi(strings.TrimPrefix(address, fdPrefix))
+		if err != nil || fd < 0 {
+			return nil, &net.AddrError{Err: "invalid file descriptor", Addr: address}
+		}
+		return fileListener(uintptr(fd), address)
+	}
+
+	return net.Listen("tcp", address)
+}
+
+// listenUnix listens on Unix domain socket of the path. The stale socket
+// is removed and the permissions are changed to the mode if it is not zero.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, &net.OpError{Op: "listen", Net: "unix", Err: errors.New("socket is in use")}
+		}
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// fileListener returns the listener of the file descriptor,
+// the descriptor itself is closed since the listener uses its copy
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	f := os.NewFile(fd, name)
+	if f == nil {
+		return nil, &net.AddrError{Err: "invalid file descriptor", Addr: name}
+	}
+	defer f.Close()
+
+	return net.FileListener(f)
+}
+
+// InheritedListeners returns the listeners passed by systemd socket activation
+// in the order of the file descriptors starting from 3. It returns nil if
+// the environment variables LISTEN_FDS and LISTEN_PID do not define them for
+// the process. The variables are unset, so the listeners are taken only once
+// and they are not passed to the child processes.
+func InheritedListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	return inheritedListeners(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), listenFdsStart)
+}
+
+// inheritedListeners returns the listeners of the number of file descriptors
+// from start if the process id is empty or matches the current process
+func inheritedListeners(pid, fds string, start int) ([]net.Listener, error) {
+	if fds == "" {
+		return nil, nil
+	}
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 0 {
+		return nil, ErrInvalidListenFds
+	}
+	listeners := make([]net.Listener, 0, count)
+	for fd := start; fd < start+count; fd++ {
+		l, err := fileListener(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
@@ -0,0 +1,181 @@
+//go:build !windows
+// +build !windows
+
+package bit
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// dupListener returns the copy of file descriptor of new TCP listener
+func dupListener(t *testing.T) (int, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fd, l.Addr().String()
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bit.sock")
+	r := NewRouter()
+	r.GET("/ping", func(c Control) {
+		c.Body("pong")
+	})
+	result := make(chan error, 1)
+	go func() {
+		result <- r.ListenWithOptions(unixPrefix+path, ServerOptions{SocketMode: 0660})
+	}()
+	client := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	var resp *http.Response
+	for i := 0; i < 100; i++ {
+		if resp, err = client.Get("http://unix/ping"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "pong" {
+		t.Error("Expected", "pong", "got", string(data))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Error("Expected", os.FileMode(0660), "got", info.Mode().Perm())
+	}
+	if _, err := listen(unixPrefix+path, ServerOptions{}); err == nil {
+		t.Error("Expected error for the socket in use")
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Error("Expected nil error of shutdown, got", err)
+	}
+	if err := <-result; err != nil {
+		t.Error("Expected nil error of serve, got", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the socket is removed, got", err)
+	}
+}
+
+func TestListenUnixStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bit.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = listen(unixPrefix+path, ServerOptions{})
+	if err != nil {
+		t.Fatal("Expected the stale socket is replaced, got", err)
+	}
+	l.Close()
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen(unixPrefix+file, ServerOptions{}); err == nil {
+		t.Error("Expected error for the regular file")
+	}
+}
+
+func TestListenFd(t *testing.T) {
+	fd, addr := dupListener(t)
+	l, err := listen(fdPrefix+strconv.Itoa(fd), ServerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.Addr().String() != addr {
+		t.Error("Expected", addr, "got", l.Addr().String())
+	}
+	for _, address := range []string{"fd:x", "fd:-1"} {
+		if _, err := listen(address, ServerOptions{}); err == nil {
+			t.Error("Expected error for", address)
+		}
+	}
+}
+
+func TestInheritedListeners(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		pid, fds string
+		count    int
+		err      error
+	}{
+		{"", "", 0, nil},
+		{"1", "1", 0, nil},
+		{pid, "x", 0, ErrInvalidListenFds},
+		{pid, "-1", 0, ErrInvalidListenFds},
+		{pid, "1", 1, nil},
+		{"", "1", 1, nil},
+	}
+	for _, test := range tests {
+		fd, addr := dupListener(t)
+		listeners, err := inheritedListeners(test.pid, test.fds, fd)
+		if err != test.err {
+			t.Error("Expected", test.err, "got", err)
+		}
+		if len(listeners) != test.count {
+			t.Error("Expected", test.count, "listeners, got", len(listeners))
+		}
+		for _, l := range listeners {
+			if l.Addr().String() != addr {
+				t.Error("Expected", addr, "got", l.Addr().String())
+			}
+			l.Close()
+		}
+		if test.count == 0 {
+			syscall.Close(fd)
+		}
+	}
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	if listeners, err := InheritedListeners(); listeners != nil || err != nil {
+		t.Error("Expected no listeners for other process, got", listeners, err)
+	}
+	if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" {
+		t.Error("Expected the environment is unset")
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogEntry contains information about the handled request
+type AccessLogEntry struct {
+	// Time when the request is started
+	Time time.Time
+
+	Method string
+
+	// Pattern of the matched route e.g. `/users/:id`,
+	// it is empty if the route is not found
+	Route string
+
+	// Path and query of the request as it is sent by the client
+	URI string
+
+	Proto string
+
+	// Parameters of the matched route
+	Params Params
+
+	// Status code sent to the client
+	Status int
+
+	// Number of bytes of the body written to the client before compression
+	Bytes int64
+
+	// Time spent to handle the request
+	Latency time.Duration
+
+	RemoteAddr string
+
+	// User name of the basic authentication
+	User string
+
+	// Error returned by the handler or replied by Control.Error
+	Error error
+}
+
+// AccessLogSink receives the entries of the access log
+type AccessLogSink interface {
+	Log(entry AccessLogEntry)
+}
+
+// AccessLogFunc is an adapter to use the function as AccessLogSink
+type AccessLogFunc func(entry AccessLogEntry)
+
+// Log calls f(entry)
+func (f AccessLogFunc) Log(entry AccessLogEntry) {
+	f(entry)
+}
+
+// AccessLogFormat defines the format of entries written by NewAccessLogWriter
+type AccessLogFormat int
+
+const (
+	// FormatJSON writes the entry as JSON object on the line
+	FormatJSON AccessLogFormat = iota
+
+	// FormatLogfmt writes the entry as key=value pairs
+	FormatLogfmt
+
+	// FormatCommon writes the entry in Common Log Format
+	FormatCommon
+)
+
+// Time format of the Common Log Format
+const commonLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLog returns the middleware which passes the information about every
+// handled request to the sink. The middleware may be used via Router.Use or
+// Router.SetupMiddleware, the requests which are not routed are logged if
+// Router.UseGlobalMiddleware is enabled.
+func AccessLog(sink AccessLogSink) func(func(Control)) func(Control) {
+	return func(next func(Control)) func(Control) {
+		return func(c Control) {
+			start := time.Now()
+			next(c)
+			req := c.Request()
+			entry := AccessLogEntry{
+				Time:       start,
+				Method:     req.Method,
+				Route:      c.Route(),
+				URI:        req.RequestURI,
+				Proto:      req.Proto,
+				Status:     c.StatusCode(),
+				Bytes:      c.BytesWritten(),
+				Latency:    time.Since(start),
+				RemoteAddr: req.RemoteAddr,
+				Error:      c.GetError(),
+			}
+			if entry.Status == 0 {
+				// nothing is written, the server replies with status code 200
+				entry.Status = http.StatusOK
+			}
+			if entry.URI == "" {
+				entry.URI = req.URL.RequestURI()
+			}
+			// the parameters are copied since the control is reused
+			if params := *c.Params(); len(params) > 0 {
+				entry.Params = make(Params, len(params))
+				copy(entry.Params, params)
+			}
+			if user, _, ok := req.BasicAuth(); ok {
+				entry.User = user
+			}
+			sink.Log(entry)
+		}
+	}
+}
+
+// accessLogWriter writes the entries in the format into the writer
+type accessLogWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format AccessLogFormat
+	buf    bytes.Buffer
+}
+
+// NewAccessLogWriter returns the sink which writes the entries of the access log
+// into the writer in the format, one entry on the line. It is safe for concurrent use.
+func NewAccessLogWriter(w io.Writer, format AccessLogFormat) AccessLogSink {
+	return &accessLogWriter{w: w, format: format}
+}
+
+// Log writes the entry into the writer
+func (l *accessLogWriter) Log(entry AccessLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf.Reset()
+	switch l.format {
+	case FormatLogfmt:
+		writeLogfmt(&l.buf, entry)
+	case FormatCommon:
+		writeCommon(&l.buf, entry)
+	default:
+		writeJSON(&l.buf, entry)
+	}
+	l.buf.WriteByte('\n')
+	l.w.Write(l.buf.Bytes())
+}
+
+// paramName returns the key of the parameter without prefix e.g. `id` for `:id`
+func paramName(key string) string {
+	if len(key) > 1 && (key[0] == ':' || key[0] == '*') {
+		return key[1:]
+	}
+
+	return key
+}
+
+func writeJSON(buf *bytes.Buffer, entry AccessLogEntry) {
+	record := struct {
+		Time       string            `json:"time"`
+		Method     string            `json:"method"`
+		Route      string            `json:"route,omitempty"`
+		URI        string            `json:"uri"`
+		Proto      string            `json:"proto"`
+		Params     map[string]string `json:"params,omitempty"`
+		Status     int               `json:"status"`
+		Bytes      int64             `json:"bytes"`
+		Latency    float64           `json:"latency_ms"`
+		RemoteAddr string            `json:"remote_addr"`
+		User       string            `json:"user,omitempty"`
+		Error      string            `json:"error,omitempty"`
+	}{
+		Time:       entry.Time.Format(time.RFC3339Nano),
+		Method:     entry.Method,
+		Route:      entry.Route,
+		URI:        entry.URI,
+		Proto:      entry.Proto,
+		Status:     entry.Status,
+		Bytes:      entry.Bytes,
+		Latency:    float64(entry.Latency) / float64(time.Millisecond),
+		RemoteAddr: entry.RemoteAddr,
+		User:       entry.User,
+	}
+	if len(entry.Params) > 0 {
+		record.Params = make(map[string]string, len(entry.Params))
+		for _, param := range entry.Params {
+			record.Params[paramName(param.Key)] = param.Value
+		}
+	}
+	if entry.Error != nil {
+		record.Error = entry.Error.Error()
+	}
+	data, _ := json.Marshal(record)
+	buf.Write(data)
+}
+
+func writeLogfmt(buf *bytes.Buffer, entry AccessLogEntry) {
+	pair := func(key, value string) {
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		if value == "" || strings.ContainsAny(value, " =\"\\") || strings.IndexFunc(value, isControl) >= 0 {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+	pair("time", entry.Time.Format(time.RFC3339Nano))
+	pair("method", entry.Method)
+	if entry.Route != "" {
+		pair("route", entry.Route)
+	}
+	pair("uri", entry.URI)
+	pair("proto", entry.Proto)
+	for _, param := range entry.Params {
+		pair("param."+paramName(param.Key), param.Value)
+	}
+	pair("status", strconv.Itoa(entry.Status))
+	pair("bytes", strconv.FormatInt(entry.Bytes, 10))
+	pair("latency", entry.Latency.String())
+	pair("remote_addr", entry.RemoteAddr)
+	if entry.User != "" {
+		pair("user", entry.User)
+	}
+	if entry.Error != nil {
+		pair("error", entry.Error.Error())
+	}
+}
+
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
+
+// writeCommon writes the entry in Common Log Format e.g.
+// `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`
+func writeCommon(buf *bytes.Buffer, entry AccessLogEntry) {
+	host := entry.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" {
+		host = "-"
+	}
+	user := entry.User
+	if user == "" {
+		user = "-"
+	}
+	bytesSent := "-"
+	if entry.Bytes > 0 {
+		bytesSent = strconv.FormatInt(entry.Bytes, 10)
+	}
+	buf.WriteString(host)
+	buf.WriteString(" - ")
+	buf.WriteString(user)
+	buf.WriteString(" [")
+	buf.WriteString(entry.Time.Format(commonLogTime))
+	buf.WriteString("] ")
+	buf.WriteString(strconv.Quote(entry.Method + " " + entry.URI + " " + entry.Proto))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.Itoa(entry.Status))
+	buf.WriteByte(' ')
+	buf.WriteString(bytesSent)
+}
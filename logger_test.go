@@ -0,0 +1,107 @@
+package bit
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	var entries []AccessLogEntry
+	r := getRouterForTesting()
+	r.Use(AccessLog(AccessLogFunc(func(entry AccessLogEntry) {
+		entries = append(entries, entry)
+	})))
+	r.UseGlobalMiddleware(true)
+	r.GET("/users/:id<int>", func(c Control) {
+		time.Sleep(time.Millisecond)
+		c.Code(http.StatusAccepted)
+		c.Body("User " + c.Query(":id"))
+	})
+	r.HandleE("GET", "/fail", func(c Control) error {
+		return errors.New("failed")
+	})
+	r.GET("/empty", func(c Control) {})
+	for _, path := range []string{"/users/12?full=1", "/fail", "/empty", "/unknown"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "192.168.1.1:54321"
+		req.SetBasicAuth("frank", "secret")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(entries) != 4 {
+		t.Fatal("Expected 4 entries, got", len(entries))
+	}
+	entry := entries[0]
+	if entry.Method != "GET" || entry.Route != "/users/:id<int>" || entry.URI != "/users/12?full=1" ||
+		entry.Proto != "HTTP/1.1" || entry.Status != http.StatusAccepted || entry.Bytes != 7 ||
+		entry.RemoteAddr != "192.168.1.1:54321" || entry.User != "frank" || entry.Error != nil {
+		t.Error("Unexpected entry", entry)
+	}
+	if len(entry.Params) != 1 || entry.Params[0] != (Param{Key: ":id", Value: "12"}) {
+		t.Error("Expected params :id=12, got", entry.Params)
+	}
+	if entry.Latency < time.Millisecond {
+		t.Error("Expected latency at least 1ms, got", entry.Latency)
+	}
+	if entry.Time.IsZero() {
+		t.Error("Expected time of the request")
+	}
+	if entry = entries[1]; entry.Status != http.StatusInternalServerError || entry.Error == nil || entry.Error.Error() != "failed" {
+		t.Error("Expected status 500 and the error, got", entry.Status, entry.Error)
+	}
+	if entry = entries[2]; entry.Status != http.StatusOK || entry.Bytes != 0 || entry.Route != "/empty" {
+		t.Error("Expected status 200, empty body and the route, got", entry.Status, entry.Bytes, entry.Route)
+	}
+	if entry = entries[3]; entry.Status != http.StatusNotFound || entry.Route != "" {
+		t.Error("Expected status 404 and empty route, got", entry.Status, entry.Route)
+	}
+}
+
+func TestAccessLogWriter(t *testing.T) {
+	entry := AccessLogEntry{
+		Time:       time.Date(2017, 10, 1, 17, 33, 56, 0, time.UTC),
+		Method:     "GET",
+		Route:      "/users/:id",
+		URI:        "/users/12?q=a b",
+		Proto:      "HTTP/1.1",
+		Params:     Params{{Key: ":id", Value: "12"}},
+		Status:     http.StatusOK,
+		Bytes:      2326,
+		Latency:    1500 * time.Microsecond,
+		RemoteAddr: "127.0.0.1:8080",
+		User:       "frank",
+		Error:      errors.New("not \"found\""),
+	}
+	tests := []struct {
+		format   AccessLogFormat
+		expected string
+	}{
+		{FormatJSON, `{"time":"2017-10-01T17:33:56Z","method":"GET","route":"/users/:id","uri":"/users/12?q=a b",` +
+			`"proto":"HTTP/1.1","params":{"id":"12"},"status":200,"bytes":2326,"latency_ms":1.5,` +
+			`"remote_addr":"127.0.0.1:8080","user":"frank","error":"not \"found\""}`},
+		{FormatLogfmt, `time=2017-10-01T17:33:56Z method=GET route=/users/:id uri="/users/12?q=a b" ` +
+			`proto=HTTP/1.1 param.id=12 status=200 bytes=2326 latency=1.5ms remote_addr=127.0.0.1:8080 ` +
+			`user=frank error="not \"found\""`},
+		{FormatCommon, `127.0.0.1 - frank [01/Oct/2017:17:33:56 +0000] "GET /users/12?q=a b HTTP/1.1" 200 2326`},
+	}
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		sink := NewAccessLogWriter(buf, test.format)
+		sink.Log(entry)
+		sink.Log(entry)
+		expected := test.expected + "\n" + test.expected + "\n"
+		if buf.String() != expected {
+			t.Error("Expected", expected, "got", buf.String())
+		}
+	}
+	// empty values
+	buf := new(bytes.Buffer)
+	NewAccessLogWriter(buf, FormatCommon).Log(AccessLogEntry{Method: "GET", URI: "/", Proto: "HTTP/1.0", Status: 304})
+	if !strings.HasPrefix(buf.String(), "- - - [") || !strings.HasSuffix(buf.String(), `] "GET / HTTP/1.0" 304 -`+"\n") {
+		t.Error("Unexpected entry", buf.String())
+	}
+}
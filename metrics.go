@@ -0,0 +1,254 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Media type of the Prometheus text exposition format
+const metricsMediaType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds in seconds of the buckets
+// of the request duration histogram which are used by default
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metricKey is a set of labels of the metric
+type metricKey struct {
+	method, route, code string
+}
+
+// histogram counts observations by buckets, the counts are not cumulative
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects the number of requests, the histogram of request durations
+// and the number of requests in flight labeled by method, route pattern and
+// status code. The metrics are exposed in Prometheus text format.
+// The requests which are not routed have empty route label, the methods
+// which are not standard have "other" method label and the panics
+// are counted with 500 status code.
+type Metrics struct {
+	mu        sync.Mutex
+	buckets   []float64
+	requests  map[metricKey]uint64
+	durations map[metricKey]*histogram
+	inFlight  map[metricKey]int64
+}
+
+// NewMetrics returns new metrics with the buckets of the request duration
+// histogram in seconds. If the buckets are not defined, DefaultBuckets are used.
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+
+	return &Metrics{
+		buckets:   sorted,
+		requests:  make(map[metricKey]uint64),
+		durations: make(map[metricKey]*histogram),
+		inFlight:  make(map[metricKey]int64),
+	}
+}
+
+// Register adds the middleware to the router and registers the handler
+// which exposes the metrics by GET method on the path e.g. `/metrics`.
+func (m *Metrics) Register(r Router, path string) {
+	r.Use(m.Middleware)
+	r.GET(path, m.Handler)
+}
+
+// Middleware collects the metrics of the requests handled by the wrapped handler
+func (m *Metrics) Middleware(next func(Control)) func(Control) {
+	return func(c Control) {
+		start := time.Now()
+		gauge := metricKey{method: metricMethod(c.Request().Method), route: c.Route()}
+		m.mu.Lock()
+		m.inFlight[gauge]++
+		m.mu.Unlock()
+		defer func() {
+			// the panic is counted as internal server error and passed to the recovery
+			if recv := recover(); recv != nil {
+				m.observe(gauge, strconv.Itoa(http.StatusInternalServerError), time.Since(start).Seconds())
+				panic(recv)
+			}
+			code := c.StatusCode()
+			if code == 0 {
+				code = http.StatusOK
+			}
+			m.observe(gauge, strconv.Itoa(code), time.Since(start).Seconds())
+		}()
+		next(c)
+	}
+}
+
+// metricMethod returns the method label, the methods which are not standard
+// are labeled as "other" to bound the number of the metrics
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+
+	return "other"
+}
+
+// observe counts the finished request
+func (m *Metrics) observe(gauge metricKey, code string, seconds float64) {
+	key := metricKey{method: gauge.method, route: gauge.route, code: code}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[gauge]--
+	m.requests[key]++
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[key] = h
+	}
+	if idx := sort.SearchFloat64s(m.buckets, seconds); idx < len(m.buckets) {
+		h.counts[idx]++
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Handler replies with the metrics in Prometheus text format
+func (m *Metrics) Handler(c Control) {
+	c.Header().Set("Content-Type", metricsMediaType)
+	c.Body(m.String())
+}
+
+// String returns the metrics in Prometheus text format
+func (m *Metrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var buf bytes.Buffer
+
+	buf.WriteString("# HELP http_requests_total Total number of HTTP requests.\n")
+	buf.WriteString("# TYPE http_requests_total counter\n")
+	for _, key := range sortedKeys(m.requests) {
+		buf.WriteString("http_requests_total")
+		writeLabels(&buf, key, "")
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatUint(m.requests[key], 10))
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteString("# HELP http_request_duration_seconds Duration of HTTP requests in seconds.\n")
+	buf.WriteString("# TYPE http_request_duration_seconds histogram\n")
+	for _, key := range sortedKeys(m.requests) {
+		h := m.durations[key]
+		var cumulative uint64
+		for idx, bound := range m.buckets {
+			cumulative += h.counts[idx]
+			buf.WriteString("http_request_duration_seconds_bucket")
+			writeLabels(&buf, key, formatFloat(bound))
+			buf.WriteByte(' ')
+			buf.WriteString(strconv.FormatUint(cumulative, 10))
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("http_request_duration_seconds_bucket")
+		writeLabels(&buf, key, "+Inf")
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatUint(h.count, 10))
+		buf.WriteByte('\n')
+		buf.WriteString("http_request_duration_seconds_sum")
+		writeLabels(&buf, key, "")
+		buf.WriteByte(' ')
+		buf.WriteString(formatFloat(h.sum))
+		buf.WriteByte('\n')
+		buf.WriteString("http_request_duration_seconds_count")
+		writeLabels(&buf, key, "")
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatUint(h.count, 10))
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteString("# HELP http_requests_in_flight Number of HTTP requests being handled.\n")
+	buf.WriteString("# TYPE http_requests_in_flight gauge\n")
+	gauges := make([]metricKey, 0, len(m.inFlight))
+	for key := range m.inFlight {
+		gauges = append(gauges, key)
+	}
+	sortKeys(gauges)
+	for _, key := range gauges {
+		buf.WriteString("http_requests_in_flight")
+		writeLabels(&buf, key, "")
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(m.inFlight[key], 10))
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+func sortedKeys(values map[metricKey]uint64) []metricKey {
+	keys := make([]metricKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+
+	return keys
+}
+
+func sortKeys(keys []metricKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+}
+
+// writeLabels writes the labels of the key, the code is omitted
+// if it is empty and the bucket label is added if le is not empty
+func writeLabels(buf *bytes.Buffer, key metricKey, le string) {
+	buf.WriteString(`{method="`)
+	buf.WriteString(escapeLabel(key.method))
+	buf.WriteString(`",route="`)
+	buf.WriteString(escapeLabel(key.route))
+	if key.code != "" {
+		buf.WriteString(`",code="`)
+		buf.WriteString(key.code)
+	}
+	if le != "" {
+		buf.WriteString(`",le="`)
+		buf.WriteString(le)
+	}
+	buf.WriteString(`"}`)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes the label value according to the text exposition format
+func escapeLabel(value string) string {
+	return labelReplacer.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
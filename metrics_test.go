@@ -0,0 +1,155 @@
+package bit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(0.5, 0.1)
+	r := getRouterForTesting()
+	m.Register(r, "/metrics")
+	r.GET("/users/:name", func(c Control) {
+		c.Body("Hello " + c.Query(":name"))
+	})
+	r.POST("/users", func(c Control) {
+		c.Error(NewProblem(http.StatusConflict, ""))
+	})
+	r.GET("/inflight", func(c Control) {
+		if !strings.Contains(m.String(), `http_requests_in_flight{method="GET",route="/inflight"} 1`) {
+			t.Error("Expected the request in flight, got", m.String())
+		}
+	})
+	requests := []struct {
+		method, path string
+	}{
+		{"GET", "/users/john"},
+		{"GET", "/users/ann"},
+		{"POST", "/users"},
+		{"GET", "/inflight"},
+	}
+	for _, req := range requests {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, httptest.NewRequest("GET", "/metrics", nil))
+	if trw.Code != http.StatusOK {
+		t.Error("Expected", http.StatusOK, "got", trw.Code)
+	}
+	if contentType := trw.Header().Get("Content-Type"); contentType != metricsMediaType {
+		t.Error("Expected", metricsMediaType, "got", contentType)
+	}
+	body := trw.Body.String()
+	expected := []string{
+		"# TYPE http_requests_total counter\n",
+		`http_requests_total{method="GET",route="/users/:name",code="200"} 2` + "\n",
+		`http_requests_total{method="POST",route="/users",code="409"} 1` + "\n",
+		"# TYPE http_request_duration_seconds histogram\n",
+		`http_request_duration_seconds_bucket{method="GET",route="/users/:name",code="200",le="0.1"} 2` + "\n",
+		`http_request_duration_seconds_bucket{method="GET",route="/users/:name",code="200",le="0.5"} 2` + "\n",
+		`http_request_duration_seconds_bucket{method="GET",route="/users/:name",code="200",le="+Inf"} 2` + "\n",
+		`http_request_duration_seconds_count{method="GET",route="/users/:name",code="200"} 2` + "\n",
+		`http_request_duration_seconds_sum{method="POST",route="/users",code="409"} `,
+		"# TYPE http_requests_in_flight gauge\n",
+		`http_requests_in_flight{method="GET",route="/users/:name"} 0` + "\n",
+		`http_requests_in_flight{method="GET",route="/metrics"} 1` + "\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Error("Expected", line, "got", body)
+		}
+	}
+	if strings.Index(body, `route="/inflight"`) > strings.Index(body, `route="/users"`) {
+		t.Error("Expected metrics sorted by route, got", body)
+	}
+}
+
+func TestMetricsNotFound(t *testing.T) {
+	m := NewMetrics()
+	r := getRouterForTesting()
+	r.UseGlobalMiddleware(true)
+	r.Use(m.Middleware)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/unknown", nil))
+	expected := `http_requests_total{method="GET",route="",code="404"} 1`
+	if !strings.Contains(m.String(), expected) {
+		t.Error("Expected", expected, "got", m.String())
+	}
+	if count := strings.Count(m.String(), "_bucket{"); count != len(DefaultBuckets)+1 {
+		t.Error("Expected", len(DefaultBuckets)+1, "buckets, got", count)
+	}
+}
+
+func TestMetricsObserve(t *testing.T) {
+	m := NewMetrics(1, 2)
+	gauge := metricKey{method: "GET", route: "/a\"b\\c\n"}
+	m.inFlight[gauge]++
+	m.observe(gauge, "200", 1)
+	m.inFlight[gauge]++
+	m.observe(gauge, "200", 1.5)
+	m.inFlight[gauge]++
+	m.observe(gauge, "200", 3)
+	expected := []string{
+		`route="/a\"b\\c\n",code="200",le="1"} 1`,
+		`route="/a\"b\\c\n",code="200",le="2"} 2`,
+		`route="/a\"b\\c\n",code="200",le="+Inf"} 3`,
+		`http_request_duration_seconds_sum{method="GET",route="/a\"b\\c\n",code="200"} 5.5`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(m.String(), line) {
+			t.Error("Expected", line, "got", m.String())
+		}
+	}
+}
+
+func TestMetricsPanic(t *testing.T) {
+	m := NewMetrics()
+	r := getRouterForTesting()
+	r.SetupRecoveryHandler(func(Control) {})
+	r.Use(m.Middleware)
+	r.GET("/panic", func(Control) {
+		panic("handler failed")
+	})
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, httptest.NewRequest("GET", "/panic", nil))
+	if trw.Code != http.StatusInternalServerError {
+		t.Error("Expected", http.StatusInternalServerError, "got", trw.Code)
+	}
+	expected := []string{
+		`http_requests_total{method="GET",route="/panic",code="500"} 1`,
+		`http_requests_in_flight{method="GET",route="/panic"} 0`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(m.String(), line) {
+			t.Error("Expected", line, "got", m.String())
+		}
+	}
+}
+
+func TestMetricsMethod(t *testing.T) {
+	m := NewMetrics()
+	r := getRouterForTesting()
+	r.UseGlobalMiddleware(true)
+	r.Use(m.Middleware)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/unknown", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("OPTIONS", "/unknown", nil))
+	expected := []string{
+		`http_requests_total{method="other",route="",code="404"} 1`,
+		`http_requests_in_flight{method="other",route=""} 0`,
+		`method="OPTIONS",route=""`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(m.String(), line) {
+			t.Error("Expected", line, "got", m.String())
+		}
+	}
+	if strings.Contains(m.String(), "PURGE") {
+		t.Error("Expected method label other, got", m.String())
+	}
+	for method, expected := range map[string]string{"GET": "GET", "TRACE": "TRACE", "get": "other", "": "other"} {
+		if label := metricMethod(method); label != expected {
+			t.Error("Expected", expected, "got", label)
+		}
+	}
+}
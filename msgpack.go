@@ -0,0 +1,263 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// marshalMsgpack encodes data into MessagePack format.
+// The struct fields are named by `msgpack` tag or `json` tag if the first one is absent.
+func marshalMsgpack(data interface{}) ([]byte, error) {
+	var buf []byte
+	if err := encodeMsgpack(&buf, reflect.ValueOf(data)); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+func encodeMsgpack(buf *[]byte, v reflect.Value) error {
+	if !v.IsValid() {
+		*buf = append(*buf, 0xc0)
+		return nil
+	}
+	if v.Type().Implements(textMarshalerType) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		encodeMsgpackString(buf, string(text))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			*buf = append(*buf, 0xc3)
+		} else {
+			*buf = append(*buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeMsgpackInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		encodeMsgpackUint(buf, v.Uint())
+	case reflect.Float32:
+		*buf = appendUint(append(*buf, 0xca), uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		*buf = appendUint(append(*buf, 0xcb), math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		encodeMsgpackString(buf, v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			*buf = append(*buf, 0xc0)
+			return nil
+		}
+		return encodeMsgpack(buf, v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			*buf = append(*buf, 0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			encodeMsgpackBinary(buf, v.Bytes())
+			return nil
+		}
+		return encodeMsgpackArray(buf, v)
+	case reflect.Array:
+		return encodeMsgpackArray(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			*buf = append(*buf, 0xc0)
+			return nil
+		}
+		return encodeMsgpackMap(buf, v)
+	case reflect.Struct:
+		return encodeMsgpackStruct(buf, v)
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func encodeMsgpackInt(buf *[]byte, n int64) {
+	switch {
+	case n >= 0:
+		encodeMsgpackUint(buf, uint64(n))
+	case n >= -32:
+		*buf = append(*buf, byte(n))
+	case n >= math.MinInt8:
+		*buf = append(*buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		*buf = appendUint(append(*buf, 0xd1), uint64(n), 2)
+	case n >= math.MinInt32:
+		*buf = appendUint(append(*buf, 0xd2), uint64(n), 4)
+	default:
+		*buf = appendUint(append(*buf, 0xd3), uint64(n), 8)
+	}
+}
+
+func encodeMsgpackUint(buf *[]byte, n uint64) {
+	switch {
+	case n <= math.MaxInt8:
+		*buf = append(*buf, byte(n))
+	case n <= math.MaxUint8:
+		*buf = append(*buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		*buf = appendUint(append(*buf, 0xcd), n, 2)
+	case n <= math.MaxUint32:
+		*buf = appendUint(append(*buf, 0xce), n, 4)
+	default:
+		*buf = appendUint(append(*buf, 0xcf), n, 8)
+	}
+}
+
+func encodeMsgpackString(buf *[]byte, s string) {
+	n := uint64(len(s))
+	switch {
+	case n < 32:
+		*buf = append(*buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		*buf = append(*buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		*buf = appendUint(append(*buf, 0xda), n, 2)
+	default:
+		*buf = appendUint(append(*buf, 0xdb), n, 4)
+	}
+	*buf = append(*buf, s...)
+}
+
+func encodeMsgpackBinary(buf *[]byte, b []byte) {
+	n := uint64(len(b))
+	switch {
+	case n <= math.MaxUint8:
+		*buf = append(*buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		*buf = appendUint(append(*buf, 0xc5), n, 2)
+	default:
+		*buf = appendUint(append(*buf, 0xc6), n, 4)
+	}
+	*buf = append(*buf, b...)
+}
+
+func encodeMsgpackArray(buf *[]byte, v reflect.Value) error {
+	encodeMsgpackHeader(buf, uint64(v.Len()), 0x90, 0xdc)
+	for i := 0; i < v.Len(); i++ {
+		if err := encodeMsgpack(buf, v.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeMsgpackMap(buf *[]byte, v reflect.Value) error {
+	keys := v.MapKeys()
+	// the keys are sorted to make the output stable
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	encodeMsgpackHeader(buf, uint64(len(keys)), 0x80, 0xde)
+	for _, key := range keys {
+		if err := encodeMsgpack(buf, key); err != nil {
+			return err
+		}
+		if err := encodeMsgpack(buf, v.MapIndex(key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeMsgpackStruct(buf *[]byte, v reflect.Value) error {
+	type field struct {
+		name  string
+		value reflect.Value
+	}
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag, ok := sf.Tag.Lookup("msgpack")
+		if !ok {
+			tag = sf.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			name, options = tag[:idx], tag[idx+1:]
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if strings.Contains(options, "omitempty") && isEmptyValue(v.Field(i)) {
+			continue
+		}
+		fields = append(fields, field{name: name, value: v.Field(i)})
+	}
+	encodeMsgpackHeader(buf, uint64(len(fields)), 0x80, 0xde)
+	for _, f := range fields {
+		encodeMsgpackString(buf, f.name)
+		if err := encodeMsgpack(buf, f.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeMsgpackHeader writes size of array or map using fix format
+// for less than 16 elements, the 16-bit or 32-bit format for others
+func encodeMsgpackHeader(buf *[]byte, n uint64, fix, format16 byte) {
+	switch {
+	case n < 16:
+		*buf = append(*buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		*buf = appendUint(append(*buf, format16), n, 2)
+	default:
+		*buf = appendUint(append(*buf, format16+1), n, 4)
+	}
+}
+
+// appendUint appends n bytes of the value in big-endian order
+func appendUint(buf []byte, value uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		buf = append(buf, byte(value>>(uint(i)*8)))
+	}
+
+	return buf
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
@@ -0,0 +1,63 @@
+package bit
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalMsgpack(t *testing.T) {
+	type embedded struct {
+		ID      int               `msgpack:"id"`
+		Skip    string            `json:"-"`
+		Empty   string            `json:"empty,omitempty"`
+		Tags    []string          `json:"tags"`
+		Data    []byte            `json:"data"`
+		Attrs   map[string]uint16 `json:"attrs"`
+		private int
+	}
+	var nilPtr *embedded
+	tests := []struct {
+		data     interface{}
+		expected string
+	}{
+		{nil, "\xc0"},
+		{true, "\xc3"},
+		{false, "\xc2"},
+		{5, "\x05"},
+		{-3, "\xfd"},
+		{-100, "\xd0\x9c"},
+		{200, "\xcc\xc8"},
+		{-200, "\xd1\xff\x38"},
+		{70000, "\xce\x00\x01\x11\x70"},
+		{-70000, "\xd2\xff\xfe\xee\x90"},
+		{uint64(math.MaxUint64), "\xcf\xff\xff\xff\xff\xff\xff\xff\xff"},
+		{int64(math.MinInt64), "\xd3\x80\x00\x00\x00\x00\x00\x00\x00"},
+		{float32(1.5), "\xca\x3f\xc0\x00\x00"},
+		{1.5, "\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00"},
+		{"abc", "\xa3abc"},
+		{strings.Repeat("a", 40), "\xd9\x28" + strings.Repeat("a", 40)},
+		{[]int{1, 2}, "\x92\x01\x02"},
+		{[2]bool{true, false}, "\x92\xc3\xc2"},
+		{map[string]int{"b": 2, "a": 1}, "\x82\xa1a\x01\xa1b\x02"},
+		{nilPtr, "\xc0"},
+		{time.Date(2017, 10, 1, 0, 0, 0, 0, time.UTC), "\xb42017-10-01T00:00:00Z"},
+		{
+			&embedded{ID: 1, Skip: "x", Tags: []string{"go"}, Data: []byte{1}, Attrs: map[string]uint16{"x": 300}, private: 1},
+			"\x84\xa2id\x01\xa4tags\x91\xa2go\xa4data\xc4\x01\x01\xa5attrs\x81\xa1x\xcd\x01\x2c",
+		},
+	}
+	for _, test := range tests {
+		result, err := marshalMsgpack(test.data)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(result) != test.expected {
+			t.Errorf("Expected %x got %x for %v", test.expected, result, test.data)
+		}
+	}
+	if _, err := marshalMsgpack(func() {}); err == nil {
+		t.Error("Expected error for unsupported type")
+	}
+}
@@ -5,7 +5,11 @@
 package bit
 
 import (
+	"fmt"
+	"net/url"
+	"path"
 	"sort"
+	"strings"
 )
 
 const (
@@ -16,88 +20,351 @@ const (
 type handle func(Control)
 
 type parser struct {
-	fields   map[uint8]records
-	static   map[string]handle
-	wildcard records
+	// Static routes by normalized path, it is used for the exact match
+	static map[string]*record
+	// Tree of all routes except asterisk
+	tree *node
+	// List of records of the routes in order of registration
+	records records
 }
 
 type record struct {
 	key    uint16
 	handle handle
 	parts  []string
+	// Handler wrapped by the middleware of the router,
+	// it is rebuilt when the middleware is changed
+	chain handle
+	// Normalized path of the route e.g. `/users/:id<int>`
+	pattern string
+	// Name of the route which is used to build URL
+	name string
+	// Keys of parameters without constraints, e.g. `:id` for `:id<int>`
+	keys []string
+	// Matchers of parameter constraints, nil for the parts without constraints
+	matchers []matcher
+	// Number of parameters which have constraints
+	constrained uint8
+	// The route ends with the wildcard and matches the rest of the path
+	wildcard bool
 }
 
 type records []*record
 
-func (n records) Len() int           { return len(n) }
-func (n records) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
-func (n records) Less(i, j int) bool { return n[i].key < n[j].key }
+func (n records) Len() int      { return len(n) }
+func (n records) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n records) Less(i, j int) bool {
+	if n[i].key == n[j].key {
+		return n[i].constrained > n[j].constrained
+	}
+	return n[i].key < n[j].key
+}
 
-func newParser() *parser {
-	return &parser{
-		fields:   make(map[uint8]records),
-		static:   make(map[string]handle),
-		wildcard: records{},
+// info returns exported information about the route
+func (r *record) info(method string) RouteInfo {
+	info := RouteInfo{
+		Method:  method,
+		Pattern: r.pattern,
+		Name:    r.name,
+		Kind:    RouteStatic,
+		Handler: r.handle,
+	}
+	for idx, key := range r.keys {
+		if key != "" {
+			info.Params = append(info.Params, key)
+		} else if len(r.parts[idx]) >= 1 && r.parts[idx][0:1] == asterisk {
+			// unnamed wildcard
+			info.Params = append(info.Params, asterisk)
+		}
+	}
+	if r.wildcard {
+		info.Kind = RouteWildcard
+	} else if r.dynamic() > 0 {
+		info.Kind = RouteParam
 	}
+
+	return info
 }
 
-func (p *parser) register(path string, h handle) bool {
-	if trim(path, " ") == asterisk {
-		p.static[asterisk] = h
+// url builds the path of the route from the parameters. The parameters
+// are searched by the key with or without prefix e.g. `:id` or `id`.
+func (r *record) url(params []Param) (string, error) {
+	if r.parts == nil && r.wildcard {
+		return "", fmt.Errorf("cannot build URL of route %q", r.pattern)
+	}
+	b := make([]byte, 0, len(r.pattern))
+	for idx, part := range r.parts {
+		if key := r.keys[idx]; key != "" || part[0:1] == asterisk {
+			if key == "" {
+				key = asterisk
+			}
+			value, ok := paramValue(params, key)
+			if !ok {
+				return "", fmt.Errorf("missing parameter %q for route %q", key, r.pattern)
+			}
+			if value == "" && part[0:1] != asterisk {
+				return "", fmt.Errorf("empty parameter %q for route %q", key, r.pattern)
+			}
+			if part[0:1] == asterisk {
+				for _, item := range strings.Split(trim(value, "/"), "/") {
+					if item != "" {
+						b = append(append(b, '/'), url.PathEscape(item)...)
+					}
+				}
+				break
+			}
+			if m := r.matchers[idx]; m != nil && !m(value) {
+				return "", fmt.Errorf("parameter %q=%q does not match route %q", key, value, r.pattern)
+			}
+			part = url.PathEscape(value)
+		}
+		b = append(append(b, '/'), part...)
+	}
+	if len(b) == 0 {
+		return "/", nil
+	}
+
+	return string(b), nil
+}
+
+// paramValue finds the value of the parameter by key with or without prefix
+func paramValue(params []Param, key string) (string, bool) {
+	for _, param := range params {
+		if param.Key == key || (len(key) > 1 && param.Key == key[1:]) {
+			return param.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// dynamic returns number of parameters in the route
+func (r *record) dynamic() uint16 {
+	return r.key >> 8
+}
 
+// prior checks whether the record takes priority over other record:
+// the routes without wildcard go first, then the routes with less number
+// of parameters. Otherwise the record found first in the tree is used.
+func (r *record) prior(other *record) bool {
+	if other == nil {
 		return true
 	}
-	if parts, ok := split(path); ok {
-		var static, dynamic, wildcard uint16
-		for _, value := range parts {
-			if len(value) >= 1 && value[0:1] == ":" {
-				dynamic++
-			} else if len(value) == 1 && value == "*" {
-				wildcard++
-			} else {
-				static++
+	if r.wildcard != other.wildcard {
+		return other.wildcard
+	}
+
+	return r.dynamic() < other.dynamic()
+}
+
+// params collects the values of parameters from the matched path
+func (r *record) params(path string, result *Params) {
+	var value string
+	for idx, part := range r.parts {
+		if len(part) >= 1 && part[0:1] == asterisk {
+			// named wildcard captures the remainder of the path
+			if key := r.keys[idx]; key != "" {
+				*result = append(*result, Param{Key: key, Value: trim(path, "/")})
 			}
+			break
 		}
-		if wildcard > 0 {
-			p.wildcard = append(p.wildcard, &record{key: dynamic<<8 + static, handle: h, parts: parts})
-		} else if dynamic == 0 {
-			p.static["/"+join(parts)] = h
-		} else {
-			level := uint8(len(parts))
-			p.fields[level] = append(p.fields[level], &record{key: dynamic<<8 + static, handle: h, parts: parts})
-			sort.Sort(records(p.fields[level]))
+		value, path = segment(path)
+		if len(part) >= 1 && part[0:1] == ":" {
+			*result = append(*result, Param{Key: r.keys[idx], Value: value})
 		}
-		return true
+	}
+}
+
+// build makes the path from the static parts of the route
+// and the values of parameters of the matched path
+func (r *record) build(path string) string {
+	b := make([]byte, 0, len(path))
+	var value string
+	for _, part := range r.parts {
+		if len(part) >= 1 && part[0:1] == asterisk {
+			if rest := trim(path, "/"); rest != "" {
+				b = append(append(b, '/'), rest...)
+			}
+			break
+		}
+		value, path = segment(path)
+		if len(part) >= 1 && part[0:1] == ":" {
+			part = value
+		}
+		b = append(append(b, '/'), part...)
+	}
+	if len(b) == 0 {
+		return "/"
 	}
 
-	return false
+	return string(b)
 }
 
-func (p *parser) get(path string) (h handle, result Params, ok bool) {
-	if h, ok := p.static[asterisk]; ok {
-		return h, nil, true
+func newParser() *parser {
+	return &parser{
+		static: make(map[string]*record),
+		tree:   new(node),
 	}
-	if h, ok := p.static[path]; ok {
-		return h, nil, true
+}
+
+// register adds the route, it returns an error if the path is invalid
+// or the route conflicts with already registered one.
+func (p *parser) register(path string, h handle) error {
+	_, err := p.add(path, h, false)
+	return err
+}
+
+// add registers the route and returns its record. If the route conflicts
+// with already registered one, it replaces the registered route when
+// the replace is true, otherwise the route is not registered.
+// In both cases the error describes the conflict.
+func (p *parser) add(path string, h handle, replace bool) (*record, error) {
+	rec, err := newRecord(path, h)
+	if err != nil {
+		return nil, err
 	}
-	if parts, ok := split(path); ok {
-		if h, ok := p.static["/"+join(parts)]; ok {
-			return h, nil, true
+	var target **record
+	if rec.pattern == asterisk {
+		existing := p.static[asterisk]
+		target = &existing
+	} else {
+		target = &p.tree.walk(rec).record
+	}
+	if existing := *target; existing != nil {
+		if existing.pattern == rec.pattern {
+			err = fmt.Errorf("route %q is already registered", rec.pattern)
+		} else {
+			err = fmt.Errorf("route %q conflicts with registered route %q", rec.pattern, existing.pattern)
+		}
+		if !replace {
+			return nil, err
 		}
-		if data := p.fields[uint8(len(parts))]; data != nil {
-			if h, result, ok := parseParams(data, parts); ok {
-				return h, result, ok
+		for idx := range p.records {
+			if p.records[idx] == existing {
+				p.records = append(p.records[:idx], p.records[idx+1:]...)
+				break
 			}
 		}
-		// try to match wildcard route
-		if h, result, ok := parseParams(p.wildcard, parts); ok {
-			return h, result, ok
+		if p.static[existing.pattern] == existing {
+			delete(p.static, existing.pattern)
+		}
+		// the name of the route is kept by the record which replaces it
+		rec.name = existing.name
+	}
+	*target = rec
+	if rec.dynamic() == 0 && !rec.wildcard || rec.pattern == asterisk {
+		p.static[rec.pattern] = rec
+	}
+	if rec.pattern != asterisk {
+		p.records = append(p.records, rec)
+	}
+
+	return rec, err
+}
+
+// newRecord parses the path and makes the record of the route
+func newRecord(path string, h handle) (*record, error) {
+	if trim(path, " ") == asterisk {
+		return &record{handle: h, pattern: asterisk, wildcard: true}, nil
+	}
+	parts, ok := split(path)
+	if !ok {
+		return nil, fmt.Errorf("path %q has more than %d segments", path, maxLevel-1)
+	}
+	var static, dynamic uint16
+	rec := &record{
+		handle:   h,
+		parts:    parts,
+		keys:     make([]string, len(parts)),
+		matchers: make([]matcher, len(parts)),
+	}
+	for idx, value := range parts {
+		if len(value) >= 1 && value[0:1] == ":" {
+			key, m, ok := parseParam(value)
+			if !ok {
+				return nil, fmt.Errorf("invalid parameter %q in path %q", value, path)
+			}
+			if m != nil {
+				rec.constrained++
+			}
+			rec.keys[idx], rec.matchers[idx] = key, m
+			dynamic++
+		} else if len(value) >= 1 && value[0:1] == asterisk {
+			if len(value) > 1 {
+				rec.keys[idx] = value
+			}
+			rec.wildcard = true
+			break
+		} else {
+			static++
 		}
 	}
+	rec.key = dynamic<<8 + static
+	rec.pattern = "/" + join(parts)
+
+	return rec, nil
+}
+
+// lookup finds the record of the route which matches the path and appends
+// values of its parameters to the params (if they are not nil).
+// The path is walked segment by segment without any allocations.
+func (p *parser) lookup(path string, params *Params) *record {
+	if rec, ok := p.static[asterisk]; ok {
+		return rec
+	}
+	if rec, ok := p.static[path]; ok {
+		return rec
+	}
+	var rec *record
+	p.tree.match(path, 0, false, &rec)
+	if rec != nil && params != nil {
+		rec.params(path, params)
+	}
+
+	return rec
+}
+
+// fold finds the route comparing static segments case-insensitively
+// and returns the path with the static segments of the route.
+func (p *parser) fold(path string) (string, bool) {
+	var rec *record
+	p.tree.match(path, 0, true, &rec)
+	if rec == nil {
+		return "", false
+	}
+
+	return rec.build(path), true
+}
+
+func (p *parser) get(path string) (h handle, result Params, ok bool) {
+	if rec := p.lookup(path, &result); rec != nil {
+		return rec.handle, result, true
+	}
 
 	return nil, nil, false
 }
 
+// segment returns the first non-empty segment of the path and the rest of the path
+func segment(path string) (string, string) {
+	for len(path) > 0 {
+		start := 0
+		for start < len(path) && path[start] == '/' {
+			start++
+		}
+		end := start
+		for end < len(path) && path[end] != '/' {
+			end++
+		}
+		value := trim(path[start:end], " ")
+		path = path[end:]
+		if value != "" {
+			return value, path
+		}
+	}
+
+	return "", ""
+}
+
 func split(path string) ([]string, bool) {
 	sdata := explode(trim(path, "/"))
 	if len(sdata) == 0 {
@@ -121,6 +388,23 @@ func split(path string) ([]string, bool) {
 	return nil, false
 }
 
+// cleanPath returns the canonical form of the path: it removes repeated slashes,
+// `.` and `..` elements. The trailing slash is kept.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	cp := path.Clean(p)
+	if p[len(p)-1] == '/' && cp != "/" {
+		cp += "/"
+	}
+
+	return cp
+}
+
 func trim(str, sep string) string {
 	result := str
 	for {
@@ -187,43 +471,23 @@ func explode(s string) []string {
 	return a[0 : na+1]
 }
 
-func parseParams(data records, parts []string) (h handle, result Params, ok bool) {
-	for _, nds := range data {
-		values := nds.parts
-		result = nil
-		found := true
-		for idx, value := range values {
-			if len(value) == 1 && value == "*" {
-				break
-			} else if value != parts[idx] && !(len(value) >= 1 && value[0:1] == ":") {
-				found = false
-				break
-			} else {
-				if len(value) >= 1 && value[0:1] == ":" {
-					result = append(result, Param{Key: value, Value: parts[idx]})
-				}
-			}
-		}
-		if found {
-			return nds.handle, result, true
-		}
+// list returns the records of all routes in order of their priority
+func (p *parser) list() records {
+	var rs records
+	if rec, ok := p.static[asterisk]; ok {
+		rs = append(rs, rec)
 	}
+	sorted := make(records, len(p.records))
+	copy(sorted, p.records)
+	sort.Stable(sorted)
 
-	return nil, nil, false
+	return append(rs, sorted...)
 }
 
 func (p *parser) routes() []string {
 	var rs []string
-	for path := range p.static {
-		rs = append(rs, path)
-	}
-	for _, records := range p.fields {
-		for _, record := range records {
-			rs = append(rs, "/"+join(record.parts))
-		}
-	}
-	for _, record := range p.wildcard {
-		rs = append(rs, "/"+join(record.parts))
+	for _, record := range p.list() {
+		rs = append(rs, record.pattern)
 	}
 
 	return rs
@@ -3,6 +3,9 @@ package bit
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -246,9 +249,8 @@ func TestParserSplit(t *testing.T) {
 		if !ok {
 			if strings.HasPrefix(p, "/A/A/A") {
 				parser := newParser()
-				result := parser.register(p, func(Control) {})
-				if result {
-					t.Error("Expected false result, got", result)
+				if err := parser.register(p, func(Control) {}); err == nil {
+					t.Error("Expected error for path with", maxLevel, "segments")
 				}
 				continue
 			}
@@ -327,3 +329,335 @@ func TestSortRecords(t *testing.T) {
 		t.Error("Less doesn't work, expected", r[1].key, "less then", r[0].key)
 	}
 }
+
+func TestParserConstraints(t *testing.T) {
+	p := newParser()
+	for _, path := range []string{
+		"/users/:name",
+		"/users/:id<int>",
+		"/users/:id<uuid>/posts/:slug<[a-z-]+>",
+		"/orders/:id<uint>",
+	} {
+		data := path
+		if err := p.register(path, func(c Control) { c.Body(data) }); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := p.register("/users/:id<[a-z>", func(Control) {}); err == nil {
+		t.Error("Expected error for invalid constraint")
+	}
+	tests := []struct {
+		path, route string
+		params      Params
+	}{
+		{"/users/12", "/users/:id<int>", Params{{":id", "12"}}},
+		{"/users/john", "/users/:name", Params{{":name", "john"}}},
+		{
+			"/users/123e4567-e89b-12d3-a456-426655440000/posts/hello-world",
+			"/users/:id<uuid>/posts/:slug<[a-z-]+>",
+			Params{{":id", "123e4567-e89b-12d3-a456-426655440000"}, {":slug", "hello-world"}},
+		},
+		{"/users/12/posts/hello-world", "", nil},
+		{"/users/123e4567-e89b-12d3-a456-426655440000/posts/Hello", "", nil},
+		{"/orders/-1", "", nil},
+	}
+	for _, test := range tests {
+		h, params, ok := p.get(test.path)
+		if ok != (test.route != "") {
+			t.Fatal("Expected found", test.route != "", "got", ok, "for", test.path)
+		}
+		if !ok {
+			continue
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Error("Expected", test.params, "got", params)
+		}
+		trw := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		h(NewControl(trw, req))
+		if trw.Body.String() != test.route {
+			t.Error("Expected", test.route, "got", trw.Body.String())
+		}
+	}
+}
+
+func TestParserNamedWildcard(t *testing.T) {
+	p := newParser()
+	p.register("/static/*filepath", func(Control) {})
+	p.register("/files/:dir/*", func(Control) {})
+	tests := []struct {
+		path   string
+		found  bool
+		params Params
+	}{
+		{"/static/css/style.css", true, Params{{"*filepath", "css/style.css"}}},
+		{"/static/index.html/", true, Params{{"*filepath", "index.html"}}},
+		{"/static", true, Params{{"*filepath", ""}}},
+		{"/files/css/style.css", true, Params{{":dir", "css"}}},
+		{"/files/css", true, Params{{":dir", "css"}}},
+		{"/files", false, nil},
+	}
+	for _, test := range tests {
+		_, params, ok := p.get(test.path)
+		if ok != test.found {
+			t.Error("Expected found", test.found, "got", ok, "for", test.path)
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Error("Expected", test.params, "got", params, "for", test.path)
+		}
+	}
+}
+
+func benchmarkParserGet(b *testing.B, path string) {
+	p := newParser()
+	benchmarkRoutes(func(path string, h handle) { p.register(path, h) })
+	params := make(Params, 0, 8)
+	if p.lookup(path, &params) == nil {
+		b.Fatal("Route not found", path)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		p.lookup(path, &params)
+	}
+}
+
+func BenchmarkParserStatic(b *testing.B) {
+	benchmarkParserGet(b, benchmarkPaths["Static"])
+}
+
+func BenchmarkParserParam(b *testing.B) {
+	benchmarkParserGet(b, benchmarkPaths["Param"])
+}
+
+func BenchmarkParserMultiParam(b *testing.B) {
+	benchmarkParserGet(b, benchmarkPaths["MultiParam"])
+}
+
+func BenchmarkParserWildcard(b *testing.B) {
+	benchmarkParserGet(b, benchmarkPaths["Wildcard"])
+}
+
+// linearParser is the former matcher which scans the dynamic routes of the same
+// level and all wildcard routes one by one, it is kept to compare the benchmarks
+type linearParser struct {
+	fields   map[int]records
+	static   map[string]handle
+	wildcard records
+}
+
+func newLinearParser() *linearParser {
+	return &linearParser{fields: make(map[int]records), static: make(map[string]handle)}
+}
+
+func (p *linearParser) register(path string, h handle) {
+	parts, _ := split(path)
+	var static, dynamic uint16
+	wildcard := false
+	rec := &record{handle: h, parts: parts, keys: make([]string, len(parts)), matchers: make([]matcher, len(parts))}
+	for idx, value := range parts {
+		switch value[0] {
+		case ':':
+			rec.keys[idx], rec.matchers[idx], _ = parseParam(value)
+			dynamic++
+		case '*':
+			if len(value) > 1 {
+				rec.keys[idx] = value
+			}
+			wildcard = true
+		default:
+			static++
+		}
+	}
+	rec.key = dynamic<<8 + static
+	switch {
+	case wildcard:
+		p.wildcard = append(p.wildcard, rec)
+	case dynamic == 0:
+		p.static["/"+join(parts)] = h
+	default:
+		p.fields[len(parts)] = append(p.fields[len(parts)], rec)
+		sort.Stable(p.fields[len(parts)])
+	}
+}
+
+func (p *linearParser) get(path string) (handle, Params, bool) {
+	if h, ok := p.static[path]; ok {
+		return h, nil, true
+	}
+	parts, _ := split(path)
+	if h, ok := p.static["/"+join(parts)]; ok {
+		return h, nil, true
+	}
+	if h, result, ok := linearParams(p.fields[len(parts)], parts); ok {
+		return h, result, true
+	}
+
+	return linearParams(p.wildcard, parts)
+}
+
+func linearParams(data records, parts []string) (handle, Params, bool) {
+	for _, rec := range data {
+		var result Params
+		found := true
+		for idx, value := range rec.parts {
+			if value[0] == '*' {
+				if key := rec.keys[idx]; key != "" {
+					var rest []string
+					if idx < len(parts) {
+						rest = parts[idx:]
+					}
+					result = append(result, Param{Key: key, Value: join(rest)})
+				}
+				break
+			} else if idx >= len(parts) {
+				found = false
+				break
+			} else if value[0] == ':' {
+				if m := rec.matchers[idx]; m != nil && !m(parts[idx]) {
+					found = false
+					break
+				}
+				result = append(result, Param{Key: rec.keys[idx], Value: parts[idx]})
+			} else if value != parts[idx] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return rec.handle, result, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// benchmarkRoutes calls the function with several hundred routes similar to a real API
+func benchmarkRoutes(register func(path string, h handle)) {
+	h := func(Control) {}
+	for i := 0; i < 100; i++ {
+		resource := "/api/v1/resource" + strconv.Itoa(i)
+		register(resource, h)
+		register(resource+"/:id", h)
+		register(resource+"/:id/items/:item", h)
+		register(resource+"/:id/items/:item/:action", h)
+		register("/assets/resource"+strconv.Itoa(i)+"/*filepath", h)
+	}
+}
+
+// benchmarkPaths are the paths of the benchmarks of the parsers
+var benchmarkPaths = map[string]string{
+	"Static":     "/api/v1/resource99",
+	"Param":      "/api/v1/resource99/12",
+	"MultiParam": "/api/v1/resource99/12/items/34/edit",
+	"Wildcard":   "/assets/resource99/css/style.css",
+}
+
+func TestLinearParser(t *testing.T) {
+	p := newParser()
+	benchmarkRoutes(func(path string, h handle) { p.register(path, h) })
+	lp := newLinearParser()
+	benchmarkRoutes(lp.register)
+	for _, path := range benchmarkPaths {
+		_, expected, ok := p.get(path)
+		_, params, found := lp.get(path)
+		if !ok || !found || !reflect.DeepEqual(params, expected) {
+			t.Error("Expected", expected, "got", params, "for", path)
+		}
+	}
+}
+
+func benchmarkLinearParserGet(b *testing.B, path string) {
+	p := newLinearParser()
+	benchmarkRoutes(p.register)
+	if _, _, ok := p.get(path); !ok {
+		b.Fatal("Route not found", path)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.get(path)
+	}
+}
+
+func BenchmarkLinearParserStatic(b *testing.B) {
+	benchmarkLinearParserGet(b, benchmarkPaths["Static"])
+}
+
+func BenchmarkLinearParserParam(b *testing.B) {
+	benchmarkLinearParserGet(b, benchmarkPaths["Param"])
+}
+
+func BenchmarkLinearParserMultiParam(b *testing.B) {
+	benchmarkLinearParserGet(b, benchmarkPaths["MultiParam"])
+}
+
+func BenchmarkLinearParserWildcard(b *testing.B) {
+	benchmarkLinearParserGet(b, benchmarkPaths["Wildcard"])
+}
+
+func TestParserSegment(t *testing.T) {
+	var result []string
+	for path := "//api/ v1 //  /module/"; ; {
+		var value string
+		if value, path = segment(path); value == "" {
+			break
+		}
+		result = append(result, value)
+	}
+	expected := []string{"api", "v1", "module"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Error("Expected", expected, "got", result)
+	}
+}
+
+func TestParserConflicts(t *testing.T) {
+	p := newParser()
+	for _, path := range []string{"/users", "/users/:id", "/static/*"} {
+		if err := p.register(path, func(Control) {}); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, path := range []string{
+		"/users/",
+		"/users/:name",
+		"/static/*filepath",
+		"/users/:id<[a-z>",
+		strings.Repeat("/A", maxLevel),
+	} {
+		if err := p.register(path, func(Control) {}); err == nil {
+			t.Error("Expected error for path", path)
+		}
+	}
+	// constrained parameter doesn't conflict with regular one
+	if err := p.register("/users/:id<int>", func(Control) {}); err != nil {
+		t.Error(err)
+	}
+	if routes := p.routes(); len(routes) != 4 {
+		t.Error("Expected 4 routes, got", routes)
+	}
+	// replace registered route
+	rec, err := p.add("/users/:name", func(c Control) { c.Body("replaced") }, true)
+	if err == nil || rec == nil {
+		t.Fatal("Expected replaced route with error, got", rec, err)
+	}
+	if routes := p.routes(); len(routes) != 4 {
+		t.Error("Expected 4 routes, got", routes)
+	}
+	_, params, _ := p.get("/users/john")
+	expected := Params{{":name", "john"}}
+	if !reflect.DeepEqual(params, expected) {
+		t.Error("Expected", expected, "got", params)
+	}
+	// asterisk route
+	if err := p.register("*", func(Control) {}); err != nil {
+		t.Error(err)
+	}
+	if err := p.register(" * ", func(Control) {}); err == nil {
+		t.Error("Expected error for duplicate asterisk route")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Media type of the problem details
+const problemMediaType = "application/problem+json"
+
+// Problem is an error which is replied by Control.Error
+// as problem details defined in RFC 7807.
+type Problem struct {
+	// URI reference that identifies the problem type, `about:blank` if it is empty
+	Type string
+
+	// Short summary of the problem type
+	Title string
+
+	// HTTP status code
+	Status int
+
+	// Explanation specific to this occurrence of the problem
+	Detail string
+
+	// URI reference that identifies the specific occurrence of the problem
+	Instance string
+
+	// Additional members of the problem details
+	Extensions map[string]interface{}
+}
+
+// NewProblem returns the problem with the status code, the title
+// is the text of the status code.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Error implements error interface
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+
+	return p.Title + ": " + p.Detail
+}
+
+// MarshalJSON represents the problem as JSON object,
+// the extensions are placed beside the standard members.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	members["type"] = p.Type
+	if p.Type == "" {
+		members["type"] = "about:blank"
+	}
+	if p.Title != "" {
+		members["title"] = p.Title
+	}
+	if p.Status != 0 {
+		members["status"] = p.Status
+	}
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+
+	return json.Marshal(members)
+}
+
+// problemOf converts the error into the problem. The details of unknown
+// errors are not disclosed, they are replied with status code 500.
+// The errors are recognized if they are wrapped e.g. by fmt.Errorf with `%w`.
+func problemOf(err error) *Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return problem
+	}
+	var invalid ValidationErrors
+	if errors.As(err, &invalid) {
+		p := NewProblem(http.StatusUnprocessableEntity, "The request has invalid fields")
+		p.Extensions = map[string]interface{}{"errors": invalid}
+		return p
+	}
+	switch {
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return NewProblem(http.StatusUnsupportedMediaType, "")
+	case errors.Is(err, ErrBodyTooLarge):
+		return NewProblem(http.StatusRequestEntityTooLarge, "")
+	}
+
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+// Error replies to the request with the error as problem details (RFC 7807).
+func (c *control) Error(err error) {
+	c.err = err
+	p := problemOf(err)
+	content, err := json.Marshal(p)
+	if err != nil {
+		// the extensions cannot be represented
+		content, _ = json.Marshal(&Problem{Type: p.Type, Title: p.Title, Status: p.Status, Detail: p.Detail})
+	}
+	c.w.Header().Set("Content-Type", problemMediaType)
+	c.w.Header().Set("X-Content-Type-Options", "nosniff")
+	if p.Status >= 100 && p.Status < 600 {
+		c.code = p.Status
+	} else {
+		c.code = http.StatusInternalServerError
+	}
+	c.reply(c.code, content)
+}
@@ -0,0 +1,133 @@
+package bit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProblemError(t *testing.T) {
+	p := NewProblem(http.StatusConflict, "")
+	if p.Error() != "Conflict" {
+		t.Error("Expected", "Conflict", "got", p.Error())
+	}
+	p.Detail = "user exists"
+	if p.Error() != "Conflict: user exists" {
+		t.Error("Expected", "Conflict: user exists", "got", p.Error())
+	}
+}
+
+func TestControlError(t *testing.T) {
+	custom := &Problem{
+		Type:       "https://example.com/probs/out-of-credit",
+		Title:      "You do not have enough credit.",
+		Status:     http.StatusForbidden,
+		Detail:     "Your current balance is 30, but that costs 50.",
+		Instance:   "/account/12345/msgs/abc",
+		Extensions: map[string]interface{}{"balance": 30},
+	}
+	tests := []struct {
+		err  error
+		code int
+		body string
+	}{
+		{custom, http.StatusForbidden, `{"balance":30,"detail":"Your current balance is 30, but that costs 50.",` +
+			`"instance":"/account/12345/msgs/abc","status":403,"title":"You do not have enough credit.",` +
+			`"type":"https://example.com/probs/out-of-credit"}`},
+		{ValidationErrors{{Field: "name", Rule: "required", Message: "is required"}}, http.StatusUnprocessableEntity,
+			`{"detail":"The request has invalid fields","errors":[{"field":"name","rule":"required",` +
+				`"message":"is required"}],"status":422,"title":"Unprocessable Entity","type":"about:blank"}`},
+		{ErrUnsupportedMediaType, http.StatusUnsupportedMediaType,
+			`{"status":415,"title":"Unsupported Media Type","type":"about:blank"}`},
+		{ErrBodyTooLarge, http.StatusRequestEntityTooLarge,
+			`{"status":413,"title":"Request Entity Too Large","type":"about:blank"}`},
+		{errors.New("connection refused"), http.StatusInternalServerError,
+			`{"status":500,"title":"Internal Server Error","type":"about:blank"}`},
+		{fmt.Errorf("account: %w", NewProblem(http.StatusForbidden, "")), http.StatusForbidden,
+			`{"status":403,"title":"Forbidden","type":"about:blank"}`},
+		{fmt.Errorf("bind: %w", ValidationErrors{{Field: "id", Rule: "required", Message: "is required"}}),
+			http.StatusUnprocessableEntity, `{"detail":"The request has invalid fields","errors":[{"field":"id",` +
+				`"rule":"required","message":"is required"}],"status":422,"title":"Unprocessable Entity","type":"about:blank"}`},
+		{fmt.Errorf("decode: %w", ErrBodyTooLarge), http.StatusRequestEntityTooLarge,
+			`{"status":413,"title":"Request Entity Too Large","type":"about:blank"}`},
+		{&Problem{Status: http.StatusTeapot, Extensions: map[string]interface{}{"f": func() {}}}, http.StatusTeapot,
+			`{"status":418,"type":"about:blank"}`},
+	}
+	for _, test := range tests {
+		trw := httptest.NewRecorder()
+		c := NewControl(trw, httptest.NewRequest("GET", "/", nil))
+		c.Error(test.err)
+		if trw.Code != test.code {
+			t.Error("Expected", test.code, "got", trw.Code)
+		}
+		if c.GetCode() != test.code {
+			t.Error("Expected", test.code, "got", c.GetCode())
+		}
+		if trw.Body.String() != test.body {
+			t.Error("Expected", test.body, "got", trw.Body.String())
+		}
+		if contentType := trw.Header().Get("Content-Type"); contentType != "application/problem+json" {
+			t.Error("Expected", "application/problem+json", "got", contentType)
+		}
+	}
+}
+
+func TestBindProblem(t *testing.T) {
+	var user bindUser
+	err := bindRequest("POST", "/users", "/users", "application/json", `{"name":`, &user)
+	if p, ok := err.(*Problem); !ok || p.Status != http.StatusBadRequest {
+		t.Error("Expected problem with status", http.StatusBadRequest, "got", err)
+	}
+	err = bindRequest("GET", "/users?page=first", "/users", "", "", &user)
+	if p, ok := err.(*Problem); !ok || p.Status != http.StatusBadRequest || !strings.Contains(p.Detail, "page") {
+		t.Error("Expected problem with status", http.StatusBadRequest, "got", err)
+	}
+}
+
+func TestRouterRecoveryProblem(t *testing.T) {
+	r := getRouterForTesting()
+	r.SetupRecoveryHandler(func(c Control) {
+		c.Error(NewProblem(http.StatusInternalServerError, ""))
+	})
+	r.GET("/panic", func(c Control) {
+		panic("unexpected")
+	})
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, httptest.NewRequest("GET", "/panic", nil))
+	expected := `{"status":500,"title":"Internal Server Error","type":"about:blank"}`
+	if trw.Code != http.StatusInternalServerError || trw.Body.String() != expected {
+		t.Error("Expected", http.StatusInternalServerError, expected, "got", trw.Code, trw.Body.String())
+	}
+}
+
+func TestRouterRecoveryDefaultProblem(t *testing.T) {
+	r := NewRouter()
+	recovered := false
+	r.SetupRecoveryHandler(func(c Control) {
+		recovered = true
+	})
+	r.GET("/boom", func(c Control) {
+		c.Header().Set("X-Partial", "1")
+		panic("test")
+	})
+	req := httptest.NewRequest("GET", "/boom", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if !recovered {
+		t.Error("Expected the recovery handler is called")
+	}
+	if trw.Code != http.StatusInternalServerError {
+		t.Error("Expected", http.StatusInternalServerError, "got", trw.Code)
+	}
+	if contentType := trw.Header().Get("Content-Type"); contentType != problemMediaType {
+		t.Error("Expected", problemMediaType, "got", contentType)
+	}
+	expected := `{"status":500,"title":"Internal Server Error","type":"about:blank"}`
+	if trw.Body.String() != expected {
+		t.Error("Expected", expected, "got", trw.Body.String())
+	}
+}
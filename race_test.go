@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package bit
+
+// The race detector makes sync.Pool drop items randomly and
+// adds allocations, so allocation tests are skipped.
+const raceEnabled = true
@@ -0,0 +1,159 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variable which contains the file descriptor of the pipe
+// that is used by the new process to report it is ready to serve
+const readyEnv = "BIT_READY_FD"
+
+// Time to wait for the new process to become ready which is used by default
+const defaultRestartTimeout = 30 * time.Second
+
+var (
+	// ErrRestartUnsupported is returned if the listeners cannot be passed to the new process
+	ErrRestartUnsupported = errors.New("listener does not support hot restart")
+
+	// ErrRestartNotReady is returned if the new process exits or
+	// is not ready during RestartTimeout
+	ErrRestartNotReady = errors.New("new process is not ready")
+)
+
+// restartCommand returns the command which starts the new process,
+// it is the same executable with the same arguments
+var restartCommand = func() (*exec.Cmd, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	return cmd, nil
+}
+
+// restart starts the new process which inherits the listeners in the same order
+// and waits until it is ready to serve. The new process is stopped if it is not ready.
+func restart(listeners []net.Listener, timeout time.Duration) error {
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, l := range listeners {
+		filer, ok := l.(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			return ErrRestartUnsupported
+		}
+		file, err := filer.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+	ready, notify, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	cmd, err := restartCommand()
+	if err != nil {
+		notify.Close()
+		return err
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = restartEnv(cmd.Env, len(files))
+	cmd.ExtraFiles = append(files, notify)
+	err = cmd.Start()
+	// the copy of the pipe is closed, so the reading ends if the new process exits
+	notify.Close()
+	if err != nil {
+		return err
+	}
+	if err := waitReady(ready, timeout); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	for _, l := range listeners {
+		if ul, ok := l.(*net.UnixListener); ok {
+			// the socket is used by the new process
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+
+	return cmd.Process.Release()
+}
+
+// restartEnv returns the environment of the new process, the variables
+// of socket activation describe the number of the inherited listeners
+// and the readiness pipe follows them
+func restartEnv(environ []string, count int) []string {
+	env := make([]string, 0, len(environ)+2)
+	for _, value := range environ {
+		if strings.HasPrefix(value, "LISTEN_PID=") || strings.HasPrefix(value, "LISTEN_FDS=") ||
+			strings.HasPrefix(value, "LISTEN_FDNAMES=") || strings.HasPrefix(value, readyEnv+"=") {
+			continue
+		}
+		env = append(env, value)
+	}
+
+	return append(env, "LISTEN_FDS="+strconv.Itoa(count), readyEnv+"="+strconv.Itoa(listenFdsStart+count))
+}
+
+// waitReady waits for the new process to write into the pipe during the timeout
+func waitReady(ready *os.File, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultRestartTimeout
+	}
+	result := make(chan error, 1)
+	go func() {
+		if _, err := ready.Read(make([]byte, 1)); err != nil {
+			result <- ErrRestartNotReady
+			return
+		}
+		result <- nil
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return ErrRestartNotReady
+	}
+}
+
+// notifyReady reports to the parent process that the process is ready to serve
+// if it is started by hot restart. The variable is unset, so it is reported once.
+func notifyReady() error {
+	value := os.Getenv(readyEnv)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(readyEnv)
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		return ErrRestartNotReady
+	}
+	notify := os.NewFile(uintptr(fd), readyEnv)
+	defer notify.Close()
+	_, err = notify.Write([]byte{1})
+
+	return err
+}
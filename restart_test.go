@@ -0,0 +1,234 @@
+//go:build !windows
+// +build !windows
+
+package bit
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Environment variable which makes TestHotRestartChild to serve as the new process
+const restartChildEnv = "BIT_TEST_RESTART_CHILD"
+
+func TestRestartEnv(t *testing.T) {
+	environ := []string{"HOME=/root", "LISTEN_PID=1", "LISTEN_FDS=2", "LISTEN_FDNAMES=a:b", readyEnv + "=9", "PATH=/bin"}
+	expected := []string{"HOME=/root", "PATH=/bin", "LISTEN_FDS=1", readyEnv + "=4"}
+	if env := restartEnv(environ, 1); !reflect.DeepEqual(env, expected) {
+		t.Error("Expected", expected, "got", env)
+	}
+	expected = []string{"HOME=/root", "PATH=/bin", "LISTEN_FDS=2", readyEnv + "=5"}
+	if env := restartEnv(environ, 2); !reflect.DeepEqual(env, expected) {
+		t.Error("Expected", expected, "got", env)
+	}
+}
+
+func TestNotifyReady(t *testing.T) {
+	if err := notifyReady(); err != nil {
+		t.Error("Expected nil error without the variable, got", err)
+	}
+	ready, notify, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ready.Close()
+	fd, err := syscall.Dup(int(notify.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notify.Close()
+	os.Setenv(readyEnv, strconv.Itoa(fd))
+	if err := notifyReady(); err != nil {
+		t.Error("Expected nil error, got", err)
+	}
+	if os.Getenv(readyEnv) != "" {
+		t.Error("Expected the variable is unset")
+	}
+	if err := waitReady(ready, time.Second); err != nil {
+		t.Error("Expected nil error, got", err)
+	}
+	os.Setenv(readyEnv, "x")
+	if err := notifyReady(); err != ErrRestartNotReady {
+		t.Error("Expected", ErrRestartNotReady, "got", err)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	ready, notify, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := waitReady(ready, 20*time.Millisecond); err != ErrRestartNotReady {
+		t.Error("Expected", ErrRestartNotReady, "on timeout, got", err)
+	}
+	notify.Close()
+	if err := waitReady(ready, time.Second); err != ErrRestartNotReady {
+		t.Error("Expected", ErrRestartNotReady, "on closed pipe, got", err)
+	}
+	ready.Close()
+}
+
+// plainListener hides File method of the listener
+type plainListener struct {
+	net.Listener
+}
+
+func TestRestartErrors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := restart([]net.Listener{l, plainListener{l}}, time.Second); err != ErrRestartUnsupported {
+		t.Error("Expected", ErrRestartUnsupported, "got", err)
+	}
+	command := restartCommand
+	defer func() {
+		restartCommand = command
+	}()
+	restartCommand = func() (*exec.Cmd, error) {
+		return exec.Command("true"), nil
+	}
+	if err := restart([]net.Listener{l}, time.Second); err != ErrRestartNotReady {
+		t.Error("Expected", ErrRestartNotReady, "got", err)
+	}
+	restartCommand = func() (*exec.Cmd, error) {
+		return exec.Command("sleep", "10"), nil
+	}
+	start := time.Now()
+	if err := restart([]net.Listener{l}, 50*time.Millisecond); err != ErrRestartNotReady {
+		t.Error("Expected", ErrRestartNotReady, "got", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Expected the new process is stopped on timeout")
+	}
+}
+
+// hotRestart serves the router by the options and restarts it by TestHotRestartChild
+// which serves in the mode, it returns URL of the server after the restart
+func hotRestart(t *testing.T, r Router, opts ServerOptions, mode string) string {
+	command := restartCommand
+	defer func() {
+		restartCommand = command
+	}()
+	restartCommand = func() (*exec.Cmd, error) {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHotRestartChild$")
+		cmd.Env = append(os.Environ(), restartChildEnv+"="+mode)
+		return cmd, nil
+	}
+	url, result := startServer(t, r, opts)
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Error("Expected nil error of serve, got", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected the server is shut down after restart")
+	}
+
+	return url
+}
+
+func TestHotRestart(t *testing.T) {
+	r := NewRouter()
+	r.GET("/ping", func(c Control) {
+		c.Body("parent")
+	})
+	url := hotRestart(t, r, ServerOptions{HotRestart: true}, "plain")
+	for _, path := range []string{"/ping", "/stop"} {
+		resp, err := testClient.Get(url + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if path == "/ping" && string(data) != "child" {
+			t.Error("Expected", "child", "got", string(data))
+		}
+	}
+}
+
+func TestHotRestartRedirect(t *testing.T) {
+	rl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectAddr := rl.Addr().String()
+	rl.Close()
+	r := NewRouter()
+	r.GET("/ping", func(c Control) {
+		c.Body("parent")
+	})
+	opts := ServerOptions{HotRestart: true, RedirectAddr: redirectAddr, TLSConfig: selfSignedConfig(t)}
+	url := hotRestart(t, r, opts, "redirect")
+	defer tlsTestClient.Get(url + "/stop")
+	client := &http.Client{
+		Transport: &http.Transport{DisableKeepAlives: true},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("http://" + redirectAddr + "/ping")
+	if err != nil {
+		t.Fatal("Expected the redirect is served by the new process, got", err)
+	}
+	resp.Body.Close()
+	expected := url + "/ping"
+	if location := resp.Header.Get("Location"); resp.StatusCode != http.StatusMovedPermanently || location != expected {
+		t.Error("Expected", http.StatusMovedPermanently, expected, "got", resp.StatusCode, location)
+	}
+	resp, err = tlsTestClient.Get(url + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "child" {
+		t.Error("Expected", "child", "got", string(data))
+	}
+}
+
+// TestHotRestartChild serves as the new process started by TestHotRestart
+// and TestHotRestartRedirect
+func TestHotRestartChild(t *testing.T) {
+	mode := os.Getenv(restartChildEnv)
+	if mode == "" {
+		t.Skip("it is started by TestHotRestart")
+	}
+	r := NewRouter()
+	r.GET("/ping", func(c Control) {
+		c.Body("child")
+	})
+	r.GET("/stop", func(c Control) {
+		go r.Shutdown(context.Background())
+	})
+	timer := time.AfterFunc(10*time.Second, func() {
+		r.Shutdown(context.Background())
+	})
+	defer timer.Stop()
+	opts := ServerOptions{HotRestart: true}
+	if mode == "redirect" {
+		// the address is invalid, so the inherited listener must be used
+		opts.RedirectAddr = "127.0.0.1:-1"
+		opts.TLSConfig = selfSignedConfig(t)
+	}
+	if err := r.ListenWithOptions("127.0.0.1:-1", opts); err != nil {
+		t.Error("Expected nil error of serve, got", err)
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package bit
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals which start hot restart
+var restartSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
@@ -0,0 +1,13 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build windows
+// +build windows
+
+package bit
+
+import "os"
+
+// Hot restart is not supported, the listeners cannot be inherited
+var restartSignals []os.Signal
@@ -5,8 +5,12 @@
 package bit
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type router struct {
@@ -17,12 +21,25 @@ type router struct {
 	// Nevertheless OPTIONS handlers take priority over automatic replies.
 	optionsRepliesEnabled bool
 
+	// If enabled, the registration of invalid or conflicting routes panics.
+	strictModeEnabled bool
+
+	// If enabled, the router redirects the request with trailing slash
+	// to the same path without it.
+	redirectTrailingSlashEnabled bool
+
+	// If enabled, the router redirects the request to the canonical path.
+	redirectFixedPathEnabled bool
+
 	// Configurable handler which is called when a request cannot be routed.
 	notAllowed func(Control)
 
 	// Configurable handler which is called when panic happen.
 	recoveryHandler func(Control)
 
+	// Configurable handler which replies with the error returned by handler.
+	errorHandler func(Control, error)
+
 	// Configurable middleware which is allowed to take control
 	// before registration of new handlers via GET, PUT, etc..
 	presetMiddlewareHandler func(string, string, func(Control)) (string, string, func(Control))
@@ -31,15 +48,46 @@ type router struct {
 	// before it is called standard methods e.g. GET, PUT.
 	middlewareHandler func(func(Control)) func(Control)
 
+	// Ordered chain of middleware which wraps matched handlers.
+	middleware []func(func(Control)) func(Control)
+
+	// If enabled, the middleware is applied to not found, not allowed
+	// and recovery handlers.
+	globalMiddlewareEnabled bool
+
 	// Configurable http.Handler which is called when URL path has not defined method.
-	// If it is not set, http.NotFound is used.
+	// If it is not set, the problem details with status code 404 are replied.
 	notFound func(Control)
+
+	// If enabled, the replies are compressed if the client accepts it.
+	compressionEnabled bool
+
+	// Size of the reply starting from which it is compressed
+	compressionMinSize int
+
+	// Limit of the request body size which is decoded by Bind
+	maxBodySize int64
+
+	// Custom validation rules which are used by Bind
+	validators map[string]func(interface{}, string) bool
+
+	// Named routes which are used to build URL
+	names map[string]*record
+
+	// Pool of controls which are reused between requests
+	pool sync.Pool
+
+	// Servers started by Listen or Serve which are serving,
+	// they are guarded by serverMu
+	servers  []*serving
+	serverMu sync.Mutex
 }
 
 // NewRouter returns new router that implement Router interface.
 func NewRouter() Router {
 	return &router{
-		handlers: make(map[string]*parser),
+		handlers:           make(map[string]*parser),
+		compressionEnabled: true,
 	}
 }
 
@@ -78,6 +126,44 @@ func (r *router) PATCH(path string, f func(Control)) {
 	r.register("PATCH", path, f)
 }
 
+// Handle registers a new request handle for the HTTP method. It returns an error
+// if the path is invalid or the route conflicts with already registered one.
+func (r *router) Handle(method, path string, f func(Control)) error {
+	return r.add("", method, path, f, false)
+}
+
+// HandleE registers a new request handle which returns an error for the HTTP method.
+// The error is passed to the error handler defined by SetupErrorHandler.
+func (r *router) HandleE(method, path string, f func(Control) error) error {
+	return r.Handle(method, path, r.handleError(f))
+}
+
+// Named registers a new request handle for the HTTP method with the name
+// which is used to build URL of the route.
+func (r *router) Named(name, method, path string, f func(Control)) {
+	r.registerNamed(name, method, path, f)
+}
+
+// URL builds the path of the named route substituting the parameters.
+func (r *router) URL(name string, params ...Param) (string, error) {
+	rec, ok := r.names[name]
+	if !ok {
+		return "", fmt.Errorf("route %q is not found", name)
+	}
+
+	return rec.url(params)
+}
+
+// Group returns a Group that registers handlers with the common path prefix.
+// The middleware (if any) wraps only the handlers registered through the group.
+func (r *router) Group(prefix string, middleware ...func(func(Control)) func(Control)) Group {
+	return &group{
+		router:     r,
+		prefix:     prefix,
+		middleware: middleware,
+	}
+}
+
 // If enabled, the router automatically replies to OPTIONS requests.
 // Nevertheless OPTIONS handlers take priority over automatic replies.
 // By default this option is disabled
@@ -85,6 +171,26 @@ func (r *router) UseOptionsReplies(enabled bool) {
 	r.optionsRepliesEnabled = enabled
 }
 
+// If enabled, the methods GET, POST, etc. panic if the path is invalid
+// or the route conflicts with already registered one.
+// By default this option is disabled
+func (r *router) UseStrictMode(enabled bool) {
+	r.strictModeEnabled = enabled
+}
+
+// If enabled, the router redirects the request with trailing slash
+// to the same path without it, if the route for such path exists.
+// By default this option is disabled
+func (r *router) UseRedirectTrailingSlash(enabled bool) {
+	r.redirectTrailingSlashEnabled = enabled
+}
+
+// If enabled, the router redirects the request to the canonical path.
+// By default this option is disabled
+func (r *router) UseRedirectFixedPath(enabled bool) {
+	r.redirectFixedPathEnabled = enabled
+}
+
 // SetupNotAllowedHandler defines own handler which is called when a request
 // cannot be routed.
 func (r *router) SetupNotAllowedHandler(f func(Control)) {
@@ -92,18 +198,52 @@ func (r *router) SetupNotAllowedHandler(f func(Control)) {
 }
 
 // SetupNotFoundHandler allows to define own handler for undefined URL path.
-// If it is not set, http.NotFound is used.
+// If it is not set, the problem details with status code 404 are replied.
 func (r *router) SetupNotFoundHandler(f func(Control)) {
 	r.notFound = f
 }
 
 // SetupRecoveryHandler allows to define handler that called when panic happen.
-// The handler prevents your server from crashing and should be used to return
-// http status code http.StatusInternalServerError (500)
+// The handler prevents your server from crashing, e.g. it logs the panic.
+// If the handler replies nothing, the problem details with status code
+// http.StatusInternalServerError (500) are replied.
 func (r *router) SetupRecoveryHandler(f func(Control)) {
 	r.recoveryHandler = f
 }
 
+// UseCompression allows to compress the replies by gzip, deflate or the codings
+// registered by RegisterCompressor if the client accepts it. It is enabled by default.
+func (r *router) UseCompression(value bool) {
+	r.compressionEnabled = value
+}
+
+// SetupCompressionMinSize defines the size of the reply in bytes starting
+// from which it is compressed. By default it is 1024 bytes.
+func (r *router) SetupCompressionMinSize(size int) {
+	r.compressionMinSize = size
+}
+
+// SetupMaxBodySize defines the limit of the request body size in bytes
+// which is decoded by Control.Bind. By default it is 10 MB.
+func (r *router) SetupMaxBodySize(size int64) {
+	r.maxBodySize = size
+}
+
+// SetupValidator registers the validation rule by name which may be used
+// in `validate` tags of the structs decoded by Control.Bind.
+func (r *router) SetupValidator(name string, f func(value interface{}, param string) bool) {
+	if r.validators == nil {
+		r.validators = make(map[string]func(interface{}, string) bool)
+	}
+	r.validators[name] = f
+}
+
+// SetupErrorHandler allows to define handler for the errors returned by handlers
+// registered via HandleE. If it is not set, Control.Error is used.
+func (r *router) SetupErrorHandler(f func(Control, error)) {
+	r.errorHandler = f
+}
+
 // SetupPresetMiddleware allows to define a middleware that take place
 // during registration of new handlers in the Router via methods GET, POST, etc..
 //
@@ -117,36 +257,175 @@ func (r *router) SetupPresetMiddleware(f func(string, string, func(Control)) (st
 // before it is called standard methods e.g. GET, PUT.
 func (r *router) SetupMiddleware(f func(func(Control)) func(Control)) {
 	r.middlewareHandler = f
+	r.rebuild()
 }
 
-// Listen and serve on requested host and port
-func (r *router) Listen(hostPort string) error {
-	return http.ListenAndServe(hostPort, r)
+// Use appends middleware to the ordered chain that wraps matched handlers.
+// The first appended middleware is called first.
+func (r *router) Use(middleware ...func(func(Control)) func(Control)) {
+	r.middleware = append(r.middleware, middleware...)
+	r.rebuild()
+}
+
+// If enabled, the middleware chain is applied to the not found,
+// not allowed and recovery handlers as well.
+// By default this option is disabled
+func (r *router) UseGlobalMiddleware(enabled bool) {
+	r.globalMiddlewareEnabled = enabled
 }
 
 // registers a new handler with the given path and method.
 func (r *router) register(method, path string, f func(Control)) {
+	r.registerNamed("", method, path, f)
+}
+
+// registers a new handler with the given path and method, the route
+// is saved with the name (if it's not empty) to build URL of the route.
+// In strict mode it panics if the route cannot be registered.
+func (r *router) registerNamed(name, method, path string, f func(Control)) {
+	if err := r.add(name, method, path, f, !r.strictModeEnabled); err != nil && r.strictModeEnabled {
+		panic(err)
+	}
+}
+
+// adds a new handler with the given path and method. If the replace is true,
+// the conflicting route is replaced, otherwise the handler is not registered.
+func (r *router) add(name, method, path string, f func(Control), replace bool) error {
 	if r.presetMiddlewareHandler != nil {
 		method, path, f = r.presetMiddlewareHandler(method, path, f)
 	}
+	if _, ok := r.names[name]; ok && !replace {
+		return fmt.Errorf("%s %s: route name %q is already used", method, path, name)
+	}
 	if r.handlers[method] == nil {
 		r.handlers[method] = newParser()
 	}
-	r.handlers[method].register(path, f)
+	rec, err := r.handlers[method].add(path, f, replace)
+	if rec != nil && name != "" {
+		if r.names == nil {
+			r.names = make(map[string]*record)
+		}
+		if prev, ok := r.names[name]; ok && prev != rec {
+			prev.name = ""
+		}
+		if rec.name != "" && rec.name != name {
+			// the replaced route loses its name
+			delete(r.names, rec.name)
+		}
+		rec.name = name
+	}
+	if rec != nil {
+		rec.chain = r.wrap(rec.handle)
+	}
+	if rec != nil && rec.name != "" {
+		r.names[rec.name] = rec
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", method, path, err)
+	}
+
+	return nil
 }
 
-func (r *router) recovery(w http.ResponseWriter, req *http.Request) {
+func (r *router) recovery(c *control) {
 	if recv := recover(); recv != nil {
-		c := NewControl(w, req)
-		r.recoveryHandler(c)
+		r.fallback(r.recoveryHandler, c)
+		if !c.Written() {
+			c.Error(NewProblem(http.StatusInternalServerError, ""))
+		}
 	}
 }
 
+// handleError adapts the handler which returns an error, the error is kept
+// in the control and passed to the error handler.
+func (r *router) handleError(f func(Control) error) func(Control) {
+	return func(c Control) {
+		err := f(c)
+		if err == nil {
+			return
+		}
+		if ctl, ok := c.(*control); ok {
+			ctl.setError(err)
+		}
+		if r.errorHandler != nil {
+			r.errorHandler(c, err)
+		} else {
+			c.Error(err)
+		}
+	}
+}
+
+// wraps handler by the middleware chain, the SetupMiddleware handler is the closest one.
+func (r *router) wrap(f func(Control)) func(Control) {
+	if r.middlewareHandler != nil {
+		f = r.middlewareHandler(f)
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		f = r.middleware[i](f)
+	}
+
+	return f
+}
+
+// rebuild wraps the handlers of all routes by the changed middleware chain,
+// so the chain is not built during the request
+func (r *router) rebuild() {
+	for _, parser := range r.handlers {
+		for _, rec := range parser.list() {
+			rec.chain = r.wrap(rec.handle)
+		}
+	}
+}
+
+// calls handler which is not associated with registered routes,
+// it is wrapped by the middleware if the global middleware is enabled.
+func (r *router) fallback(f func(Control), c *control) {
+	if r.globalMiddlewareEnabled {
+		f = r.wrap(f)
+	}
+	f(c)
+}
+
+// acquire gets control from the pool and prepares it for the request
+func (r *router) acquire(w http.ResponseWriter, req *http.Request) *control {
+	c, ok := r.pool.Get().(*control)
+	if !ok {
+		c = NewControl(w, req).(*control)
+	}
+	c.req, c.router = req, r
+	c.tw.reset(w)
+	c.w = &c.tw
+	if r.compressionEnabled {
+		minSize := r.compressionMinSize
+		if minSize <= 0 {
+			minSize = defaultCompressionMinSize
+		}
+		c.cw.reset(&c.tw, req, minSize)
+		c.w = &c.cw
+	}
+
+	return c
+}
+
+// release resets control and puts it back into the pool
+func (r *router) release(c *control) {
+	c.finish()
+	c.cw.ResponseWriter = nil
+	c.tw.reset(nil)
+	c.req, c.w, c.code, c.router, c.err, c.route = nil, nil, 0, nil, nil, ""
+	*c.params = (*c.params)[:0]
+	// the map is cleared instead of reallocation to keep it for the next request
+	for key := range c.store {
+		delete(c.store, key)
+	}
+	r.pool.Put(c)
+}
+
 // AllowedMethods returns list of allowed methods
 func (r *router) allowedMethods(path string) []string {
 	var allowed []string
 	for method, parser := range r.handlers {
-		if _, _, ok := parser.get(path); ok {
+		if parser.lookup(path, nil) != nil {
 			allowed = append(allowed, method)
 		}
 	}
@@ -156,22 +435,20 @@ func (r *router) allowedMethods(path string) []string {
 
 // ServeHTTP implements http.Handler interface.
 func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c := r.acquire(w, req)
+	defer r.release(c)
 	if r.recoveryHandler != nil {
-		defer r.recovery(w, req)
-	}
-	if _, ok := r.handlers[req.Method]; ok {
-		if handle, params, ok := r.handlers[req.Method].get(req.URL.Path); ok {
-			c := NewControl(w, req)
-			if len(params) > 0 {
-				for _, item := range params {
-					c.Params().Set(item.Key, item.Value)
-				}
-			}
-			if r.middlewareHandler != nil {
-				r.middlewareHandler(handle)(c)
-			} else {
-				handle(c)
-			}
+		defer r.recovery(c)
+	}
+	if parser, ok := r.handlers[req.Method]; ok {
+		rec, target := r.match(parser, req.URL.Path, c.params)
+		if rec != nil {
+			c.route = rec.pattern
+			rec.chain(c)
+			return
+		}
+		if target != "" {
+			redirect(c, "", target)
 			return
 		}
 	}
@@ -179,10 +456,9 @@ func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	if len(allowed) == 0 {
 		if r.notFound != nil {
-			c := NewControl(w, req)
-			r.notFound(c)
+			r.fallback(r.notFound, c)
 		} else {
-			http.NotFound(w, req)
+			r.fallback(notFound, c)
 		}
 		return
 	}
@@ -192,13 +468,94 @@ func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	if r.notAllowed != nil {
-		c := NewControl(w, req)
-		r.notAllowed(c)
+		r.fallback(r.notAllowed, c)
 	} else {
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		r.fallback(notAllowed, c)
 	}
 }
 
+// match finds the route of the path. If the request is redirected by the enabled
+// redirect options, the canonical path is returned instead of the route.
+func (r *router) match(p *parser, path string, params *Params) (*record, string) {
+	if r.redirectTrailingSlashEnabled || r.redirectFixedPathEnabled {
+		if target := r.canonical(path); target != path && p.lookup(target, nil) != nil {
+			return nil, target
+		}
+	}
+	if rec := p.lookup(path, params); rec != nil {
+		return rec, ""
+	}
+	if r.redirectFixedPathEnabled {
+		if target, ok := p.fold(r.canonical(path)); ok {
+			return nil, target
+		}
+	}
+
+	return nil, ""
+}
+
+// canonical returns the path that is used for redirection,
+// it never starts with `//` which would redirect to other host
+func (r *router) canonical(path string) string {
+	if r.redirectFixedPathEnabled {
+		path = cleanPath(path)
+	}
+	if r.redirectTrailingSlashEnabled {
+		for len(path) > 1 && path[len(path)-1] == '/' {
+			path = path[:len(path)-1]
+		}
+	}
+	// the target with leading `//` is the protocol-relative URL of other host
+	if len(path) > 1 && path[1] == '/' {
+		path = "/" + strings.TrimLeft(path, "/")
+	}
+
+	return path
+}
+
+// redirect replies to the request with redirection to the escaped path
+// prefixed by the origin e.g. `https://example.com`, the query is kept
+func redirect(c Control, origin, path string) {
+	code := http.StatusPermanentRedirect
+	if c.Request().Method == "GET" || c.Request().Method == "HEAD" {
+		code = http.StatusMovedPermanently
+	}
+	// the path is decoded, so it is escaped to keep e.g. `%3F` in the path
+	target := origin + (&url.URL{Path: path}).EscapedPath()
+	if query := c.Request().URL.RawQuery; query != "" {
+		target += "?" + query
+	}
+	http.Redirect(c, c.Request(), target, code)
+}
+
+// default handler for undefined URL path
+func notFound(c Control) {
+	c.Error(NewProblem(http.StatusNotFound, ""))
+}
+
+// default handler for the request which cannot be routed
+func notAllowed(c Control) {
+	c.Error(NewProblem(http.StatusMethodNotAllowed, ""))
+}
+
+// Routes returns information about all registered routes sorted by pattern and method.
+func (r *router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	for method, parser := range r.handlers {
+		for _, rec := range parser.list() {
+			routes = append(routes, rec.info(method))
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern == routes[j].Pattern {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Pattern < routes[j].Pattern
+	})
+
+	return routes
+}
+
 // Lookup allows the manual lookup of a method + path combo.
 func (r *router) Lookup(method, path string) (func(Control), Params, bool) {
 	if root := r.handlers[method]; root != nil {
@@ -206,3 +563,14 @@ func (r *router) Lookup(method, path string) (func(Control), Params, bool) {
 	}
 	return nil, nil, false
 }
+
+// LookupRedirect returns the canonical path which the request of the method
+// and the path is redirected to by the enabled redirect options.
+func (r *router) LookupRedirect(method, path string) (string, bool) {
+	if root := r.handlers[method]; root != nil {
+		if _, target := r.match(root, path, nil); target != "" {
+			return target, true
+		}
+	}
+	return "", false
+}
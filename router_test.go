@@ -2,6 +2,7 @@ package bit
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -256,6 +257,9 @@ func TestRouterNotFound(t *testing.T) {
 	if result != http.StatusNotFound {
 		t.Error("Expected", http.StatusNotFound, "got", result)
 	}
+	if contentType := trw.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Error("Expected", "application/problem+json", "got", contentType)
+	}
 }
 
 func TestRouterAllowedMethods(t *testing.T) {
@@ -298,7 +302,7 @@ func TestRouterNotAllowed(t *testing.T) {
 	r := getRouterForTesting()
 	// Registers GET handler
 	path := "/allowed"
-	message := http.StatusText(http.StatusMethodNotAllowed) + "\n"
+	message := `{"status":405,"title":"Method Not Allowed","type":"about:blank"}`
 	r.GET(path, func(c Control) {
 		c.Code(http.StatusOK)
 	})
@@ -506,3 +510,605 @@ func TestRouterLookup(t *testing.T) {
 		t.Fatalf("Wrong parameter values: want %v, got %v", wantParams, params)
 	}
 }
+
+func TestRouterUse(t *testing.T) {
+	r := getRouterForTesting()
+	trace := func(name string) func(func(Control)) func(Control) {
+		return func(f func(Control)) func(Control) {
+			return func(c Control) {
+				c.Header().Add("Trace", name)
+				f(c)
+			}
+		}
+	}
+	r.GET("/chain", func(c Control) {
+		c.Header().Add("Trace", "handler")
+	})
+	r.SetupMiddleware(trace("setup"))
+	r.Use(trace("logging"), trace("auth"))
+	r.Use(trace("metrics"))
+	req, err := http.NewRequest("GET", "/chain", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	expected := []string{"logging", "auth", "metrics", "setup", "handler"}
+	if result := trw.Header()["Trace"]; !reflect.DeepEqual(result, expected) {
+		t.Error("Expected", expected, "got", result)
+	}
+}
+
+func TestRouterUseGlobalMiddleware(t *testing.T) {
+	r := getRouterForTesting()
+	r.GET("/found", func(c Control) {
+		panic("test")
+	})
+	r.SetupRecoveryHandler(func(c Control) {
+		c.Code(http.StatusInternalServerError)
+		c.Body("recovered")
+	})
+	r.Use(func(f func(Control)) func(Control) {
+		return func(c Control) {
+			c.Header().Set("Middleware", "applied")
+			f(c)
+		}
+	})
+	for _, enabled := range []bool{false, true} {
+		r.UseGlobalMiddleware(enabled)
+		for _, request := range []struct {
+			method, path string
+			code         int
+		}{
+			{"GET", "/not-found", http.StatusNotFound},
+			{"PUT", "/found", http.StatusMethodNotAllowed},
+		} {
+			req, err := http.NewRequest(request.method, request.path, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			trw := httptest.NewRecorder()
+			r.ServeHTTP(trw, req)
+			if trw.Code != request.code {
+				t.Error("Expected", request.code, "got", trw.Code)
+			}
+			if applied := trw.Header().Get("Middleware") != ""; applied != enabled {
+				t.Error("Expected middleware applied", enabled, "got", applied, "for", request.path)
+			}
+		}
+	}
+	req, err := http.NewRequest("GET", "/found", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if trw.Code != http.StatusInternalServerError {
+		t.Error("Expected", http.StatusInternalServerError, "got", trw.Code)
+	}
+	if trw.Body.String() != "recovered" {
+		t.Error("Expected", "recovered", "got", trw.Body.String())
+	}
+}
+
+func TestRouterNamedWildcard(t *testing.T) {
+	r := getRouterForTesting()
+	r.GET("/static/*filepath", func(c Control) {
+		c.Body("File: " + c.Query("*filepath"))
+	})
+	req, err := http.NewRequest("GET", "/static/js/app.js", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	expected := "File: js/app.js"
+	if trw.Body.String() != expected {
+		t.Error("Expected", expected, "got", trw.Body.String())
+	}
+}
+
+func TestRouterZeroAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("skipping allocation test with race detector")
+	}
+	r := getRouterForTesting()
+	r.GET("/hello", func(c Control) {})
+	r.GET("/users/:id<int>/posts/:post", func(c Control) {
+		if c.Query(":id") != "12" || c.Query(":post") != "hello" {
+			t.Error("Expected parameters", ":id", ":post", "got", c.Params())
+		}
+	})
+	r.GET("/static/*filepath", func(c Control) {
+		if c.Query("*filepath") != "css/style.css" {
+			t.Error("Expected", "css/style.css", "got", c.Query("*filepath"))
+		}
+	})
+	for _, path := range []string{
+		"/hello",
+		"/hello/",
+		"/users/12/posts/hello",
+		"/static/css/style.css",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trw := httptest.NewRecorder()
+		allocs := testing.AllocsPerRun(100, func() {
+			r.ServeHTTP(trw, req)
+		})
+		if allocs != 0 {
+			t.Error("Expected zero allocations, got", allocs, "for", path)
+		}
+	}
+}
+
+func TestRouterZeroAllocationsDefault(t *testing.T) {
+	if raceEnabled {
+		t.Skip("skipping allocation test with race detector")
+	}
+	// the default router compresses the replies
+	r := NewRouter()
+	passed := 0
+	r.Use(func(next func(Control)) func(Control) {
+		return func(c Control) {
+			passed++
+			next(c)
+		}
+	})
+	r.GET("/hello", func(c Control) {})
+	r.GET("/users/:id<int>", func(c Control) {
+		if c.Query(":id") != "12" {
+			t.Error("Expected", "12", "got", c.Query(":id"))
+		}
+	})
+	api := r.Group("/api", func(next func(Control)) func(Control) {
+		return func(c Control) {
+			c.Header()
+			next(c)
+		}
+	})
+	api.Group("/v1").GET("/posts/:post", func(c Control) {
+		if c.Query(":post") != "hello" {
+			t.Error("Expected", "hello", "got", c.Query(":post"))
+		}
+	})
+	for _, path := range []string{
+		"/hello",
+		"/users/12",
+		"/api/v1/posts/hello",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		trw := httptest.NewRecorder()
+		allocs := testing.AllocsPerRun(100, func() {
+			r.ServeHTTP(trw, req)
+		})
+		if allocs != 0 {
+			t.Error("Expected zero allocations, got", allocs, "for", path)
+		}
+	}
+	if passed == 0 {
+		t.Error("Expected the requests are passed through the middleware")
+	}
+}
+
+func TestRouterRedirect(t *testing.T) {
+	r := getRouterForTesting()
+	r.GET("/users/:id", func(c Control) {
+		c.Body("User " + c.Query(":id"))
+	})
+	r.POST("/users", func(c Control) {
+		c.Body("Created")
+	})
+	r.GET("/Static/*filepath", func(c Control) {
+		c.Body(c.Query("*filepath"))
+	})
+	tests := []struct {
+		trailingSlash, fixedPath bool
+		method, path             string
+		code                     int
+		location                 string
+	}{
+		{false, false, "GET", "/users/12/", http.StatusOK, ""},
+		{true, false, "GET", "/users/12/", http.StatusMovedPermanently, "/users/12"},
+		{true, false, "GET", "/users/12/?q=1", http.StatusMovedPermanently, "/users/12?q=1"},
+		{true, false, "POST", "/users/", http.StatusPermanentRedirect, "/users"},
+		{true, false, "GET", "/users//12", http.StatusOK, ""},
+		{true, false, "GET", "/unknown/", http.StatusNotFound, ""},
+		{false, true, "GET", "/users//12", http.StatusMovedPermanently, "/users/12"},
+		{false, true, "GET", "/users/../users/./12", http.StatusMovedPermanently, "/users/12"},
+		{false, true, "GET", "/users/12/", http.StatusOK, ""},
+		{false, true, "GET", "/USERS/Jane", http.StatusMovedPermanently, "/users/Jane"},
+		{false, true, "GET", "/static/css/Style.css", http.StatusMovedPermanently, "/Static/css/Style.css"},
+		{true, true, "GET", "/Users//12/", http.StatusMovedPermanently, "/users/12"},
+		{true, true, "GET", "/users/12", http.StatusOK, ""},
+		{true, true, "GET", "/unknown", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		r.UseRedirectTrailingSlash(test.trailingSlash)
+		r.UseRedirectFixedPath(test.fixedPath)
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, req)
+		if trw.Code != test.code {
+			t.Error("Expected", test.code, "got", trw.Code, "for", test.path)
+		}
+		if location := trw.Header().Get("Location"); location != test.location {
+			t.Error("Expected location", test.location, "got", location, "for", test.path)
+		}
+	}
+}
+
+func TestRouterRedirectLeadingSlashes(t *testing.T) {
+	r := getRouterForTesting()
+	r.GET("/:slug", func(c Control) {
+		c.Body(c.Query(":slug"))
+	})
+	tests := []struct {
+		trailingSlash, fixedPath bool
+		path, location           string
+	}{
+		{true, false, "//evil.com/", "/evil.com"},
+		{true, false, "///evil.com//", "/evil.com"},
+		{false, true, "//evil.com/", "/evil.com/"},
+		{true, true, "//evil.com", "/evil.com"},
+	}
+	for _, test := range tests {
+		r.UseRedirectTrailingSlash(test.trailingSlash)
+		r.UseRedirectFixedPath(test.fixedPath)
+		req := httptest.NewRequest("GET", "/", nil)
+		// the path as it is parsed from the request line `GET //evil.com/ HTTP/1.1`
+		req.URL.Path = test.path
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, req)
+		if location := trw.Header().Get("Location"); location != test.location {
+			t.Error("Expected location", test.location, "got", location, "for", test.path)
+		}
+	}
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.URL.Path = "//evil.com/"
+	trw := httptest.NewRecorder()
+	r.redirectHandler("443").ServeHTTP(trw, req)
+	if location := trw.Header().Get("Location"); location != "https://example.com/evil.com" {
+		t.Error("Expected location", "https://example.com/evil.com", "got", location)
+	}
+}
+
+func TestRouterLookupRedirect(t *testing.T) {
+	r := getRouterForTesting()
+	r.GET("/user/:name", func(c Control) {})
+	if _, _, ok := r.Lookup("GET", "/user/gopher"); !ok {
+		t.Error("Expected the route is found")
+	}
+	tests := []struct {
+		trailingSlash, fixedPath bool
+		path, target             string
+	}{
+		{false, false, "/user/gopher/", ""},
+		{true, false, "/user/gopher", ""},
+		{true, false, "/user/gopher/", "/user/gopher"},
+		{true, false, "/user/", ""},
+		{false, true, "/user//gopher", "/user/gopher"},
+		{false, true, "/user/../user/gopher", "/user/gopher"},
+		{false, true, "/USER/gopher", "/user/gopher"},
+		{false, true, "/unknown/gopher", ""},
+	}
+	for _, test := range tests {
+		r.UseRedirectTrailingSlash(test.trailingSlash)
+		r.UseRedirectFixedPath(test.fixedPath)
+		target, ok := r.LookupRedirect("GET", test.path)
+		if target != test.target || ok != (test.target != "") {
+			t.Error("Expected", test.target, "got", target, ok, "for", test.path)
+		}
+		if _, _, ok := r.Lookup("GET", test.path); ok && test.path == "/USER/gopher" {
+			t.Error("Expected the route is not found for", test.path)
+		}
+	}
+	if _, ok := r.LookupRedirect("POST", "/user/gopher/"); ok {
+		t.Error("Expected no redirect for not registered method")
+	}
+}
+
+func TestRouterRedirectEscaping(t *testing.T) {
+	r := getRouterForTesting()
+	r.UseRedirectTrailingSlash(true)
+	r.UseRedirectFixedPath(true)
+	r.GET("/files/*filepath", func(c Control) {
+		c.Body(c.Query("*filepath"))
+	})
+	tests := []struct {
+		url, location string
+	}{
+		{"/files//a%3Fadmin=1", "/files/a%3Fadmin=1"},
+		{"/files//a%20b/?q=1", "/files/a%20b?q=1"},
+		{"/Files/a%23b", "/files/a%23b"},
+	}
+	for _, test := range tests {
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, httptest.NewRequest("GET", test.url, nil))
+		if trw.Code != http.StatusMovedPermanently {
+			t.Error("Expected", http.StatusMovedPermanently, "got", trw.Code, "for", test.url)
+		}
+		if location := trw.Header().Get("Location"); location != test.location {
+			t.Error("Expected location", test.location, "got", location, "for", test.url)
+		}
+	}
+	trw := httptest.NewRecorder()
+	r.redirectHandler("443").ServeHTTP(trw, httptest.NewRequest("GET", "http://example.com/files//a%3Fadmin=1", nil))
+	if location := trw.Header().Get("Location"); location != "https://example.com/files/a%3Fadmin=1" {
+		t.Error("Expected location", "https://example.com/files/a%3Fadmin=1", "got", location)
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	r := getRouterForTesting()
+	h := func(c Control) {}
+	r.GET("/users/:id<int>", h)
+	r.GET("/users", h)
+	r.POST("/users", h)
+	r.GET("/static/*filepath", h)
+	r.Group("/files").GET("/:dir/*", h)
+	r.OPTIONS("*", h)
+	expected := []RouteInfo{
+		{Method: "OPTIONS", Pattern: "*", Kind: RouteWildcard},
+		{Method: "GET", Pattern: "/files/:dir/*", Params: []string{":dir", "*"}, Kind: RouteWildcard},
+		{Method: "GET", Pattern: "/static/*filepath", Params: []string{"*filepath"}, Kind: RouteWildcard},
+		{Method: "GET", Pattern: "/users", Kind: RouteStatic},
+		{Method: "POST", Pattern: "/users", Kind: RouteStatic},
+		{Method: "GET", Pattern: "/users/:id<int>", Params: []string{":id"}, Kind: RouteParam},
+	}
+	routes := r.Routes()
+	if len(routes) != len(expected) {
+		t.Fatal("Expected", len(expected), "routes, got", len(routes))
+	}
+	for idx, route := range routes {
+		if route.Handler == nil {
+			t.Error("Expected handler for", route.Pattern)
+		}
+		route.Handler = nil
+		if !reflect.DeepEqual(route, expected[idx]) {
+			t.Error("Expected", expected[idx], "got", route)
+		}
+	}
+	data, err := json.Marshal(routes[2])
+	if err != nil {
+		t.Error(err)
+	}
+	expectedJSON := `{"method":"GET","pattern":"/static/*filepath","params":["*filepath"],"kind":"wildcard"}`
+	if string(data) != expectedJSON {
+		t.Error("Expected", expectedJSON, "got", string(data))
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	r := getRouterForTesting()
+	h := func(c Control) {}
+	r.Named("user", "GET", "/users/:id<int>", h)
+	r.Named("post", "GET", "/users/:user/posts/:slug", h)
+	r.Named("root", "GET", "/", h)
+	r.Named("static", "GET", "/static/*filepath", h)
+	r.Named("files", "GET", "/files/:dir/*", h)
+	r.Group("/api/v1").Named("group", "POST", "/items/:id", h)
+	tests := []struct {
+		name     string
+		params   []Param
+		expected string
+		err      bool
+	}{
+		{"user", []Param{{":id", "12"}}, "/users/12", false},
+		{"user", []Param{{"id", "12"}}, "/users/12", false},
+		{"user", []Param{{":id", "abc"}}, "", true},
+		{"user", nil, "", true},
+		{"user", []Param{{"id", ""}}, "", true},
+		{"post", []Param{{"user", ""}, {"slug", "a"}}, "", true},
+		{"post", []Param{{"user", "john doe"}, {"slug", "a/b"}}, "/users/john%20doe/posts/a%2Fb", false},
+		{"root", nil, "/", false},
+		{"static", []Param{{"*filepath", "/css/main style.css"}}, "/static/css/main%20style.css", false},
+		{"static", []Param{{"filepath", ""}}, "/static", false},
+		{"files", []Param{{"dir", "js"}, {"*", "app.js"}}, "/files/js/app.js", false},
+		{"group", []Param{{"id", "1"}}, "/api/v1/items/1", false},
+		{"unknown", nil, "", true},
+	}
+	for _, test := range tests {
+		result, err := r.URL(test.name, test.params...)
+		if (err != nil) != test.err {
+			t.Error("Expected error", test.err, "got", err, "for", test.name, test.params)
+		}
+		if result != test.expected {
+			t.Error("Expected", test.expected, "got", result)
+		}
+	}
+	for _, route := range r.Routes() {
+		if route.Pattern == "/users/:id<int>" && route.Name != "user" {
+			t.Error("Expected name", "user", "got", route.Name)
+		}
+	}
+}
+
+func TestRouterURLReplaced(t *testing.T) {
+	r := getRouterForTesting()
+	r.Named("user", "GET", "/users/:id", func(c Control) {})
+	// the route is replaced in regular mode, the name is kept
+	r.GET("/users/:id", func(c Control) {
+		c.Body("User " + c.Query(":id"))
+	})
+	if result, err := r.URL("user", Param{"id", "1"}); err != nil || result != "/users/1" {
+		t.Error("Expected", "/users/1", "got", result, err)
+	}
+	if routes := r.Routes(); len(routes) != 1 || routes[0].Name != "user" {
+		t.Error("Expected the route with name", "user", "got", routes)
+	}
+	// the route is replaced with other name
+	r.Named("profile", "GET", "/users/:id", func(c Control) {})
+	if _, err := r.URL("user", Param{"id", "1"}); err == nil {
+		t.Error("Expected error for the name of the replaced route")
+	}
+	if result, err := r.URL("profile", Param{"id", "1"}); err != nil || result != "/users/1" {
+		t.Error("Expected", "/users/1", "got", result, err)
+	}
+	// the name is moved to other route
+	r.Named("profile", "GET", "/profiles/:id", func(c Control) {})
+	if result, err := r.URL("profile", Param{"id", "1"}); err != nil || result != "/profiles/1" {
+		t.Error("Expected", "/profiles/1", "got", result, err)
+	}
+	for _, route := range r.Routes() {
+		if route.Pattern == "/users/:id" && route.Name != "" {
+			t.Error("Expected the route without name, got", route.Name)
+		}
+	}
+}
+
+func TestRouterHandle(t *testing.T) {
+	r := getRouterForTesting()
+	h := func(c Control) {}
+	if err := r.Handle("GET", "/users/:id", h); err != nil {
+		t.Error(err)
+	}
+	if err := r.Handle("PROPFIND", "/users/:id", h); err != nil {
+		t.Error(err)
+	}
+	if err := r.Handle("GET", "/users/:id/", h); err == nil {
+		t.Error("Expected error for duplicate route")
+	}
+	if err := r.Group("/users").Handle("GET", "/:name", h); err == nil {
+		t.Error("Expected error for ambiguous route")
+	}
+	r.Named("user", "GET", "/user/:id", h)
+	if err := r.add("user", "GET", "/profile", h, false); err == nil {
+		t.Error("Expected error for duplicate route name")
+	}
+	// the routes are replaced in regular mode
+	r.GET("/users/:name", func(c Control) { c.Body("Name " + c.Query(":name")) })
+	req, err := http.NewRequest("GET", "/users/john", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if trw.Body.String() != "Name john" {
+		t.Error("Expected", "Name john", "got", trw.Body.String())
+	}
+}
+
+func TestRouterHandleE(t *testing.T) {
+	r := getRouterForTesting()
+	errNoUser := errors.New("user not found")
+	var result error
+	r.Use(func(next func(Control)) func(Control) {
+		return func(c Control) {
+			next(c)
+			result = c.GetError()
+		}
+	})
+	if err := r.HandleE("GET", "/users/:id", func(c Control) error {
+		if c.Query(":id") != "1" {
+			return errNoUser
+		}
+		c.Body("User 1")
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+	if err := r.HandleE("GET", "/users/:name", func(c Control) error { return nil }); err == nil {
+		t.Error("Expected error for ambiguous route")
+	}
+	tests := []struct {
+		path, body string
+		code       int
+		err        error
+	}{
+		{"/users/1", "User 1", http.StatusOK, nil},
+		{"/users/2", `{"status":500,"title":"Internal Server Error","type":"about:blank"}`,
+			http.StatusInternalServerError, errNoUser},
+	}
+	for _, test := range tests {
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, httptest.NewRequest("GET", test.path, nil))
+		if trw.Code != test.code || trw.Body.String() != test.body {
+			t.Error("Expected", test.code, test.body, "got", trw.Code, trw.Body.String())
+		}
+		if result != test.err {
+			t.Error("Expected", test.err, "got", result)
+		}
+	}
+	// the error handler maps the errors
+	r.SetupErrorHandler(func(c Control, err error) {
+		if err == errNoUser {
+			c.Code(http.StatusNotFound)
+			c.Body(err.Error())
+			return
+		}
+		c.Error(err)
+	})
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, httptest.NewRequest("GET", "/users/2", nil))
+	if trw.Code != http.StatusNotFound || trw.Body.String() != errNoUser.Error() {
+		t.Error("Expected", http.StatusNotFound, errNoUser, "got", trw.Code, trw.Body.String())
+	}
+	if result != errNoUser {
+		t.Error("Expected", errNoUser, "got", result)
+	}
+}
+
+func TestRouterRoute(t *testing.T) {
+	var route, handled string
+	r := getRouterForTesting()
+	r.UseGlobalMiddleware(true)
+	r.Use(func(next func(Control)) func(Control) {
+		return func(c Control) {
+			next(c)
+			route = c.Route()
+		}
+	})
+	h := func(c Control) {
+		handled = c.Route()
+	}
+	r.GET("/users/:id<int>", h)
+	r.GET("/static/*filepath", h)
+	r.Group("/api/v1").GET("/posts/:post", h)
+	r.POST("/users", h)
+	tests := []struct {
+		method, path, expected string
+	}{
+		{"GET", "/users/12", "/users/:id<int>"},
+		{"GET", "/static/css/style.css", "/static/*filepath"},
+		{"GET", "/api/v1/posts/hello", "/api/v1/posts/:post"},
+		{"POST", "/users", "/users"},
+		{"GET", "/users/john", ""},
+		{"PUT", "/users", ""},
+	}
+	for _, test := range tests {
+		route, handled = "-", ""
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(test.method, test.path, nil))
+		if route != test.expected {
+			t.Error("Expected", test.expected, "got", route, "for", test.method, test.path)
+		}
+		if handled != route && test.expected != "" {
+			t.Error("Expected", route, "in the handler, got", handled)
+		}
+	}
+}
+
+func TestRouterStrictMode(t *testing.T) {
+	r := getRouterForTesting()
+	r.UseStrictMode(true)
+	r.GET("/users/:id", func(c Control) {})
+	for _, path := range []string{"/users/:id", "/users/:name", strings.Repeat("/A", maxLevel)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected panic for path", path)
+				}
+			}()
+			r.GET(path, func(c Control) {})
+		}()
+	}
+}
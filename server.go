@@ -0,0 +1,432 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Time to drain in-flight requests on the signal which is used by default
+const defaultShutdownTimeout = 30 * time.Second
+
+// ShutdownSignals are SIGINT and SIGTERM which usually start graceful shutdown,
+// e.g. ServerOptions{Signals: bit.ShutdownSignals}
+var ShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// ServerOptions configure the HTTP server started by ListenWithOptions and Serve.
+// Zero values of the timeouts mean no timeout like in http.Server.
+type ServerOptions struct {
+	// Maximum duration for reading the entire request, including the body
+	ReadTimeout time.Duration
+
+	// Maximum duration for reading the request headers
+	ReadHeaderTimeout time.Duration
+
+	// Maximum duration before timing out writes of the response
+	WriteTimeout time.Duration
+
+	// Maximum duration to wait for the next request when keep-alives are enabled
+	IdleTimeout time.Duration
+
+	// Maximum number of bytes of the request headers,
+	// http.DefaultMaxHeaderBytes is used if it is zero
+	MaxHeaderBytes int
+
+	// Maximum duration of draining in-flight requests on the signal,
+	// it is 30 seconds by default
+	ShutdownTimeout time.Duration
+
+	// Signals which start graceful shutdown e.g. ShutdownSignals,
+	// the signals are not handled if it is empty
+	Signals []os.Signal
+
+	// Files of the certificate and the matching key in PEM format.
+	// If they are defined or TLSConfig is defined, the server serves HTTPS.
+	CertFile, KeyFile string
+
+	// Configuration of TLS, it is copied by the server. The certificates
+	// of the configuration are used if CertFile and KeyFile are empty.
+	TLSConfig *tls.Config
+
+	// File of the certificate authorities in PEM format which verify
+	// the client certificates for mutual TLS
+	ClientCAFile string
+
+	// Policy of the client authentication, it is tls.RequireAndVerifyClientCert
+	// by default if ClientCAFile is defined
+	ClientAuth tls.ClientAuthType
+
+	// Address of plain HTTP listener e.g. ":80" which redirects the requests
+	// to HTTPS server, it is not started if empty. It requires TLS, otherwise
+	// ErrRedirectWithoutTLS is returned. The redirect server uses
+	// the timeouts and the logger of the options and it is shut down
+	// together with HTTPS server.
+	RedirectAddr string
+
+	// Permissions of Unix domain sockets e.g. 0660,
+	// the permissions are not changed if it is zero
+	SocketMode os.FileMode
+
+	// If enabled, on SIGHUP or SIGUSR2 the executable is started again with
+	// the same arguments and inherits the listeners including the listener of
+	// RedirectAddr. The new process listens by ListenWithOptions with the
+	// inherited listeners instead of the addresses.
+	// Hot restart is not supported on Windows.
+	HotRestart bool
+
+	// Maximum duration to wait for the new process to become ready
+	// on hot restart, it is 30 seconds by default
+	RestartTimeout time.Duration
+
+	// Logger of the errors of the server and hot restart,
+	// the standard logger is used if it is nil
+	ErrorLog *log.Logger
+}
+
+var (
+	// ErrNoClientCA is returned if no certificates are found in ClientCAFile
+	ErrNoClientCA = errors.New("no client CA certificates found")
+
+	// ErrRedirectWithoutTLS is returned if RedirectAddr is defined,
+	// but the server does not serve HTTPS
+	ErrRedirectWithoutTLS = errors.New("redirect to HTTPS requires TLS")
+)
+
+// serving is the server started by Serve and the server which redirects
+// to it plain HTTP requests, the redirect server is nil if it is not started
+type serving struct {
+	srv, redirect *http.Server
+}
+
+// shutdown gracefully shuts down the server and the redirect server
+func (s *serving) shutdown(ctx context.Context) error {
+	err := s.srv.Shutdown(ctx)
+	if s.redirect != nil {
+		if e := s.redirect.Shutdown(ctx); err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// plainServer returns the server of plain HTTP which uses the handler
+func (opts ServerOptions) plainServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadTimeout:       opts.ReadTimeout,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+		MaxHeaderBytes:    opts.MaxHeaderBytes,
+		ErrorLog:          opts.ErrorLog,
+	}
+}
+
+// newServer returns the server which uses the router as handler
+func (opts ServerOptions) newServer(h http.Handler) (*http.Server, error) {
+	srv := opts.plainServer(h)
+	if !opts.tlsEnabled() {
+		return srv, nil
+	}
+	config := new(tls.Config)
+	if opts.TLSConfig != nil {
+		config = opts.TLSConfig.Clone()
+	}
+	if opts.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(data) {
+			return nil, ErrNoClientCA
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if opts.ClientAuth != tls.NoClientCert {
+		config.ClientAuth = opts.ClientAuth
+	}
+	srv.TLSConfig = config
+
+	return srv, nil
+}
+
+// tlsEnabled checks whether the server serves HTTPS
+func (opts ServerOptions) tlsEnabled() bool {
+	return opts.CertFile != "" || opts.KeyFile != "" || opts.TLSConfig != nil
+}
+
+// Listen and serve on requested address with default options
+func (r *router) Listen(hostPort string) error {
+	return r.ListenWithOptions(hostPort, ServerOptions{})
+}
+
+// ListenTLS listens on requested host and port and serves HTTPS
+// with the certificate and the matching key from the files
+func (r *router) ListenTLS(hostPort, certFile, keyFile string) error {
+	return r.ListenWithOptions(hostPort, ServerOptions{CertFile: certFile, KeyFile: keyFile})
+}
+
+// ListenWithOptions listens on requested address and serves the requests
+// by the server configured with the options. The address is TCP host and port
+// e.g. `:8080`, Unix domain socket e.g. `unix:/run/app.sock` or inherited
+// file descriptor e.g. `fd:3`. If hot restart is enabled, the inherited
+// listeners are used: the first one serves the requests and the second one
+// serves the redirects if RedirectAddr is defined.
+func (r *router) ListenWithOptions(hostPort string, opts ServerOptions) error {
+	if opts.HotRestart {
+		listeners, err := InheritedListeners()
+		if err != nil {
+			return err
+		}
+		if len(listeners) > 0 {
+			return r.serve(listeners, opts)
+		}
+	}
+	l, err := listen(hostPort, opts)
+	if err != nil {
+		return err
+	}
+
+	return r.Serve(l, opts)
+}
+
+// Serve accepts connections on the listener and serves the requests by the server
+// configured with the options. On the signal of the options it stops accepting new connections
+// and waits for in-flight requests during ShutdownTimeout. If hot restart is
+// enabled, on SIGHUP or SIGUSR2 the listeners are passed to the new process and
+// the server is shut down when the new process is ready. It returns nil
+// if the server is gracefully shut down.
+func (r *router) Serve(l net.Listener, opts ServerOptions) error {
+	return r.serve([]net.Listener{l}, opts)
+}
+
+// serve serves the requests on the first listener and the redirects on the second
+// one if RedirectAddr is defined, the redirect listener is created if it is absent.
+// All listeners are passed to the new process on hot restart in the same order.
+func (r *router) serve(listeners []net.Listener, opts ServerOptions) error {
+	if opts.RedirectAddr != "" && !opts.tlsEnabled() {
+		closeListeners(listeners)
+		return ErrRedirectWithoutTLS
+	}
+	l := listeners[0]
+	srv, err := opts.newServer(r)
+	if err != nil {
+		closeListeners(listeners)
+		return err
+	}
+	served := 1
+	if opts.RedirectAddr != "" {
+		served = 2
+	}
+	if len(listeners) > served {
+		// the listeners which are not served are only passed to the new process
+		defer closeListeners(listeners[served:])
+	}
+	serve := srv.Serve
+	if opts.tlsEnabled() {
+		serve = func(l net.Listener) error {
+			return srv.ServeTLS(l, opts.CertFile, opts.KeyFile)
+		}
+	}
+	s := &serving{srv: srv}
+	if opts.RedirectAddr != "" {
+		if len(listeners) < 2 {
+			rl, err := listen(opts.RedirectAddr, opts)
+			if err != nil {
+				l.Close()
+				return err
+			}
+			listeners = append(listeners, rl)
+		}
+		s.redirect = r.serveRedirect(listeners[1], l.Addr(), opts)
+	}
+	r.track(s)
+	defer r.untrack(s)
+
+	sig := notify(opts.Signals)
+	defer signal.Stop(sig)
+	var restartSig chan os.Signal
+	if opts.HotRestart {
+		restartSig = notify(restartSignals)
+		defer signal.Stop(restartSig)
+	}
+	if err := notifyReady(); err != nil {
+		logf(srv, "bit: ready notification failed: %v", err)
+	}
+	if sig == nil && restartSig == nil {
+		return s.result(serve(l))
+	}
+	stop := make(chan struct{})
+	drained := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-sig:
+			case <-restartSig:
+				if err := restart(listeners, opts.RestartTimeout); err != nil {
+					logf(srv, "bit: hot restart failed: %v", err)
+					continue
+				}
+			case <-stop:
+				drained <- nil
+				return
+			}
+			timeout := opts.ShutdownTimeout
+			if timeout <= 0 {
+				timeout = defaultShutdownTimeout
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			drained <- s.shutdown(ctx)
+			cancel()
+			return
+		}
+	}()
+	err = s.result(serve(l))
+	close(stop)
+	if err == nil {
+		// wait for draining if the shutdown is started by the signal
+		return <-drained
+	}
+
+	return err
+}
+
+// closeListeners closes all listeners
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// notify returns the channel which receives the signals, it is nil if there are no signals
+func notify(signals []os.Signal) chan os.Signal {
+	if len(signals) == 0 {
+		return nil
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signals...)
+
+	return sig
+}
+
+// logf logs the error by the logger of the server or by the standard logger
+func logf(srv *http.Server, format string, args ...interface{}) {
+	if srv.ErrorLog != nil {
+		srv.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// result returns nil instead of http.ErrServerClosed, the redirect
+// server is closed if the server fails, otherwise it is shut down
+// in the same way as the server
+func (s *serving) result(err error) error {
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	if s.redirect != nil {
+		s.redirect.Close()
+	}
+
+	return err
+}
+
+// serveRedirect starts plain HTTP server configured with the options on the
+// listener which redirects the requests to HTTPS server listening on the TLS address
+func (r *router) serveRedirect(l net.Listener, tlsAddr net.Addr, opts ServerOptions) *http.Server {
+	_, port, _ := net.SplitHostPort(tlsAddr.String())
+	srv := opts.plainServer(r.redirectHandler(port))
+	go func() {
+		if err := srv.Serve(l); err != http.ErrServerClosed {
+			logf(srv, "bit: redirect server failed: %v", err)
+		}
+	}()
+
+	return srv
+}
+
+// redirectHandler returns the handler which redirects the requests to HTTPS
+// on the port. The path is made canonical like the router does it.
+func (r *router) redirectHandler(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c := r.acquire(w, req)
+		defer r.release(c)
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		redirect(c, "https://"+host, r.canonical(req.URL.Path))
+	})
+}
+
+// track adds the server to the servers which are shut down by Shutdown
+func (r *router) track(s *serving) {
+	r.serverMu.Lock()
+	defer r.serverMu.Unlock()
+	r.servers = append(r.servers, s)
+}
+
+// untrack removes the server which is not serving anymore
+func (r *router) untrack(s *serving) {
+	r.serverMu.Lock()
+	defer r.serverMu.Unlock()
+	for idx, value := range r.servers {
+		if value == s {
+			r.servers = append(r.servers[:idx], r.servers[idx+1:]...)
+			return
+		}
+	}
+}
+
+// Shutdown gracefully shuts down all servers started by Listen or Serve.
+// They stop accepting new connections and wait for in-flight requests
+// until the context is done. It returns the first error of the servers.
+func (r *router) Shutdown(ctx context.Context) error {
+	r.serverMu.Lock()
+	servers := make([]*serving, len(r.servers))
+	copy(servers, r.servers)
+	r.serverMu.Unlock()
+	var err error
+	for _, s := range servers {
+		if e := s.shutdown(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// Server returns the last server started by Listen or Serve which is serving,
+// it is nil before the start and after the shutdown
+func (r *router) Server() *http.Server {
+	r.serverMu.Lock()
+	defer r.serverMu.Unlock()
+	if len(r.servers) == 0 {
+		return nil
+	}
+
+	return r.servers[len(r.servers)-1].srv
+}
@@ -0,0 +1,534 @@
+package bit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testClient does not keep connections, so the server has no idle
+// connections which are not used yet at the moment of shutdown
+var testClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+// tlsTestClient is testClient which accepts any certificate of the server
+var tlsTestClient = &http.Client{Transport: &http.Transport{
+	DisableKeepAlives: true,
+	TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+}}
+
+// clientFor returns the client and the URL scheme of the server configured by the options
+func clientFor(opts ServerOptions) (*http.Client, string) {
+	if opts.tlsEnabled() {
+		return tlsTestClient, "https"
+	}
+
+	return testClient, "http"
+}
+
+// selfSignedConfig returns the configuration of TLS with self-signed certificate
+func selfSignedConfig(t *testing.T) *tls.Config {
+	cert := newTestCert(t, "server", nil, x509.ExtKeyUsageServerAuth)
+	return &tls.Config{Certificates: []tls.Certificate{cert.pair()}}
+}
+
+// startServer serves the router on the local listener and returns its URL
+// and the channel which receives the result of Serve
+func startServer(t *testing.T, r Router, opts ServerOptions) (string, chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- r.Serve(l, opts)
+	}()
+	client, scheme := clientFor(opts)
+	url := scheme + "://" + l.Addr().String()
+	for i := 0; i < 100; i++ {
+		if resp, err := client.Get(url + "/ping"); err == nil {
+			resp.Body.Close()
+			return url, result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Expected the server is started")
+
+	return url, result
+}
+
+// slowRouter returns the router with the handler which replies when release is closed
+func slowRouter(started chan<- struct{}, release <-chan struct{}) Router {
+	r := NewRouter()
+	r.GET("/ping", func(c Control) {
+		c.Body("pong")
+	})
+	r.GET("/slow", func(c Control) {
+		close(started)
+		<-release
+		c.Body("done")
+	})
+
+	return r
+}
+
+// get requests the URL and sends the body of the reply or the error into the channel
+func get(url string, reply chan<- string) {
+	resp, err := testClient.Get(url)
+	if err != nil {
+		reply <- err.Error()
+		return
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	reply <- string(data)
+}
+
+func TestServeShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	r := slowRouter(started, release)
+	if r.Server() != nil {
+		t.Error("Expected nil server before the start")
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Error("Expected nil error for not started server, got", err)
+	}
+	opts := ServerOptions{
+		ReadTimeout:    time.Second,
+		WriteTimeout:   2 * time.Second,
+		IdleTimeout:    3 * time.Second,
+		MaxHeaderBytes: 4096,
+	}
+	url, result := startServer(t, r, opts)
+	srv := r.Server()
+	if srv == nil || srv.ReadTimeout != time.Second || srv.WriteTimeout != 2*time.Second ||
+		srv.IdleTimeout != 3*time.Second || srv.MaxHeaderBytes != 4096 {
+		t.Fatal("Expected server configured by the options, got", srv)
+	}
+	reply := make(chan string, 1)
+	go get(url+"/slow", reply)
+	<-started
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- r.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-shutdown:
+		t.Error("Expected shutdown waits for in-flight request, got", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if body := <-reply; body != "done" {
+		t.Error("Expected", "done", "got", body)
+	}
+	if err := <-shutdown; err != nil {
+		t.Error("Expected nil error of shutdown, got", err)
+	}
+	if err := <-result; err != nil {
+		t.Error("Expected nil error of serve, got", err)
+	}
+	if _, err := testClient.Get(url + "/ping"); err == nil {
+		t.Error("Expected the server does not accept connections after shutdown")
+	}
+}
+
+func TestServeSignal(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	r := slowRouter(started, release)
+	url, result := startServer(t, r, ServerOptions{ShutdownTimeout: 5 * time.Second, Signals: ShutdownSignals})
+	reply := make(chan string, 1)
+	go get(url+"/slow", reply)
+	<-started
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		t.Error("Expected serve waits for in-flight request, got", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if body := <-reply; body != "done" {
+		t.Error("Expected", "done", "got", body)
+	}
+	if err := <-result; err != nil {
+		t.Error("Expected nil error of serve, got", err)
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	r := slowRouter(started, release)
+	url, result := startServer(t, r, ServerOptions{})
+	go get(url+"/slow", make(chan string, 1))
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Error("Expected", context.DeadlineExceeded, "got", err)
+	}
+	if err := <-result; err != nil {
+		t.Error("Expected nil error of serve, got", err)
+	}
+}
+
+func TestServeShutdownAll(t *testing.T) {
+	r := NewRouter()
+	r.GET("/ping", func(c Control) {
+		c.Body("pong")
+	})
+	opts := ServerOptions{}
+	firstURL, firstResult := startServer(t, r, opts)
+	first := r.Server()
+	secondURL, secondResult := startServer(t, r, opts)
+	if srv := r.Server(); srv == nil || srv == first {
+		t.Error("Expected the last started server, got", srv)
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Error("Expected nil error of shutdown, got", err)
+	}
+	for _, result := range []chan error{firstResult, secondResult} {
+		if err := <-result; err != nil {
+			t.Error("Expected nil error of serve, got", err)
+		}
+	}
+	for _, url := range []string{firstURL, secondURL} {
+		if _, err := testClient.Get(url + "/ping"); err == nil {
+			t.Error("Expected the server does not accept connections after shutdown", url)
+		}
+	}
+	if srv := r.Server(); srv != nil {
+		t.Error("Expected nil server after shutdown, got", srv)
+	}
+}
+
+func TestListenWithOptions(t *testing.T) {
+	r := NewRouter()
+	if err := r.ListenWithOptions("127.0.0.1:-1", ServerOptions{}); err == nil {
+		t.Error("Expected error for invalid address")
+	}
+	if err := r.Listen("127.0.0.1:-1"); err == nil {
+		t.Error("Expected error for invalid address")
+	}
+}
+
+// testCert is the certificate with the key for the TLS tests
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert returns the certificate signed by the parent,
+// it is self-signed certificate authority if the parent is nil
+func newTestCert(t *testing.T, name string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// pair returns the certificate and the key for tls.Config
+func (c *testCert) pair() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// write writes the certificate and the key into the files of the directory in PEM format
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestServeTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCert(t, "CA", nil, x509.ExtKeyUsageAny)
+	server := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth)
+	client := newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+	certFile, keyFile := server.write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	r := NewRouter()
+	r.GET("/whoami", func(c Control) {
+		if cert := c.ClientCertificate(); cert != nil {
+			c.Body(cert.Subject.CommonName)
+			return
+		}
+		c.Body("anonymous")
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- r.Serve(l, ServerOptions{
+			CertFile:     certFile,
+			KeyFile:      keyFile,
+			ClientCAFile: caFile,
+		})
+	}()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+	}
+	url := "https://" + l.Addr().String() + "/whoami"
+	var resp *http.Response
+	for i := 0; i < 100; i++ {
+		if resp, err = newClient(client.pair()).Get(url); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "client" {
+		t.Error("Expected", "client", "got", string(data))
+	}
+	if _, err := newClient().Get(url); err == nil {
+		t.Error("Expected error for the client without certificate")
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Error("Expected nil error of shutdown, got", err)
+	}
+	if err := <-result; err != nil {
+		t.Error("Expected nil error of serve, got", err)
+	}
+}
+
+func TestServeTLSConfig(t *testing.T) {
+	ca := newTestCert(t, "CA", nil, x509.ExtKeyUsageAny)
+	server := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth)
+	r := NewRouter()
+	r.GET("/whoami", func(c Control) {
+		if c.ClientCertificate() != nil {
+			t.Error("Expected nil client certificate")
+		}
+		c.Body("anonymous")
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.Serve(l, ServerOptions{
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{server.pair()}},
+	})
+	defer r.Shutdown(context.Background())
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+	}}
+	var resp *http.Response
+	for i := 0; i < 100; i++ {
+		if resp, err = client.Get("https://" + l.Addr().String() + "/whoami"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "anonymous" || resp.TLS == nil {
+		t.Error("Expected", "anonymous", "over TLS, got", string(data), resp.TLS)
+	}
+}
+
+func TestServeTLSErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	empty := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRouter()
+	tests := []struct {
+		opts ServerOptions
+		err  error
+	}{
+		{ServerOptions{TLSConfig: &tls.Config{}, ClientCAFile: empty}, ErrNoClientCA},
+		{ServerOptions{TLSConfig: &tls.Config{}, ClientCAFile: filepath.Join(dir, "absent.pem")}, nil},
+		{ServerOptions{TLSConfig: selfSignedConfig(t), RedirectAddr: "127.0.0.1:-1"}, nil},
+		{ServerOptions{RedirectAddr: "127.0.0.1:0"}, ErrRedirectWithoutTLS},
+	}
+	for _, test := range tests {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.Serve(l, test.opts)
+		if err == nil || (test.err != nil && err != test.err) {
+			t.Error("Expected error", test.err, "got", err)
+		}
+	}
+	if err := r.ListenTLS("127.0.0.1:-1", "", ""); err == nil {
+		t.Error("Expected error for invalid address")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	r := getRouterForTesting()
+	r.UseRedirectFixedPath(true)
+	tests := []struct {
+		method, url, port string
+		code              int
+		location          string
+	}{
+		{"GET", "http://example.com/users//john?page=2", "8443", http.StatusMovedPermanently,
+			"https://example.com:8443/users/john?page=2"},
+		{"HEAD", "http://example.com:8080/", "443", http.StatusMovedPermanently, "https://example.com/"},
+		{"POST", "http://example.com/users", "", http.StatusPermanentRedirect, "https://example.com/users"},
+		{"GET", "http://[::1]:8080/a/../b", "443", http.StatusMovedPermanently, "https://[::1]/b"},
+	}
+	for _, test := range tests {
+		trw := httptest.NewRecorder()
+		r.redirectHandler(test.port).ServeHTTP(trw, httptest.NewRequest(test.method, test.url, nil))
+		if trw.Code != test.code {
+			t.Error("Expected", test.code, "got", trw.Code, "for", test.url)
+		}
+		if location := trw.Header().Get("Location"); location != test.location {
+			t.Error("Expected", test.location, "got", location)
+		}
+	}
+}
+
+func TestServeRedirect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := getRouterForTesting()
+	logger := log.New(ioutil.Discard, "", 0)
+	opts := ServerOptions{ReadTimeout: time.Second, IdleTimeout: 2 * time.Second, ErrorLog: logger}
+	srv := r.serveRedirect(l, &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8443}, opts)
+	defer srv.Close()
+	if srv.ReadTimeout != time.Second || srv.IdleTimeout != 2*time.Second || srv.ErrorLog != logger {
+		t.Error("Expected redirect server configured by the options, got", srv)
+	}
+	client := &http.Client{
+		Transport: &http.Transport{DisableKeepAlives: true},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("http://" + l.Addr().String() + "/users?id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expected := "https://127.0.0.1:8443/users?id=1"
+	if location := resp.Header.Get("Location"); resp.StatusCode != http.StatusMovedPermanently || location != expected {
+		t.Error("Expected", http.StatusMovedPermanently, expected, "got", resp.StatusCode, location)
+	}
+}
+
+func TestServeRedirectShutdown(t *testing.T) {
+	rl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectAddr := rl.Addr().String()
+	rl.Close()
+	r := NewRouter()
+	r.GET("/ping", func(c Control) {
+		c.Body("pong")
+	})
+	_, result := startServer(t, r, ServerOptions{RedirectAddr: redirectAddr, TLSConfig: selfSignedConfig(t)})
+	client := &http.Client{
+		Transport: &http.Transport{DisableKeepAlives: true},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("http://" + redirectAddr + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Error("Expected", http.StatusMovedPermanently, "got", resp.StatusCode)
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Error("Expected nil error of shutdown, got", err)
+	}
+	if err := <-result; err != nil {
+		t.Error("Expected nil error of serve, got", err)
+	}
+	if _, err := client.Get("http://" + redirectAddr + "/ping"); err == nil {
+		t.Error("Expected the redirect server does not accept connections after shutdown")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import "net/http"
+
+// tracker records the status code and the number of bytes
+// which are actually sent to the client
+type tracker struct {
+	http.ResponseWriter
+	status  int
+	size    int64
+	written bool
+}
+
+// reset prepares the tracker for the request
+func (t *tracker) reset(w http.ResponseWriter) {
+	t.ResponseWriter, t.status, t.size, t.written = w, 0, 0, false
+}
+
+// WriteHeader records the first status code except informational ones
+func (t *tracker) WriteHeader(code int) {
+	if !t.written && code >= http.StatusOK {
+		t.status, t.written = code, true
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the number of written bytes
+func (t *tracker) Write(b []byte) (int, error) {
+	if !t.written {
+		t.status, t.written = http.StatusOK, true
+	}
+	n, err := t.ResponseWriter.Write(b)
+	t.size += int64(n)
+
+	return n, err
+}
+
+// Flush sends the header with status code 200 if it isn't sent yet
+func (t *tracker) Flush() {
+	if !t.written {
+		t.status, t.written = http.StatusOK, true
+	}
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// StatusCode returns the status code sent to the client, 0 if nothing is sent yet
+func (c *control) StatusCode() int {
+	if c.pending() {
+		if c.cw.code != 0 {
+			return c.cw.code
+		}
+		return http.StatusOK
+	}
+	return c.tw.status
+}
+
+// BytesWritten returns the number of bytes of the body written to the client,
+// the compressed reply is counted before compression
+func (c *control) BytesWritten() int64 {
+	if c.w == &c.cw {
+		return c.cw.size
+	}
+	return c.tw.size
+}
+
+// Written checks whether the header is sent to the client
+func (c *control) Written() bool {
+	return c.tw.written || c.pending()
+}
+
+// pending checks whether the status code or the data is buffered while
+// the decision about compression is not made, it is reported as sent
+func (c *control) pending() bool {
+	return c.w == &c.cw && c.cw.state == compressPending && (len(c.cw.buf) > 0 || c.cw.code != 0)
+}
@@ -0,0 +1,132 @@
+package bit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestControlTracking(t *testing.T) {
+	type result struct {
+		status  int
+		size    int64
+		written bool
+	}
+	var before, after result
+	r := getRouterForTesting()
+	r.Use(func(next func(Control)) func(Control) {
+		return func(c Control) {
+			before = result{c.StatusCode(), c.BytesWritten(), c.Written()}
+			next(c)
+			after = result{c.StatusCode(), c.BytesWritten(), c.Written()}
+		}
+	})
+	r.GET("/write", func(c Control) {
+		c.WriteHeader(http.StatusCreated)
+		c.Write([]byte("Hello"))
+		c.Write([]byte(" world"))
+	})
+	r.GET("/body", func(c Control) {
+		c.Code(http.StatusAccepted)
+		c.Body("Accepted")
+	})
+	r.GET("/implicit", func(c Control) {
+		c.Write([]byte("OK"))
+	})
+	r.GET("/header", func(c Control) {
+		c.WriteHeader(http.StatusContinue)
+		c.WriteHeader(http.StatusNoContent)
+		c.WriteHeader(http.StatusOK)
+	})
+	r.GET("/error", func(c Control) {
+		c.Error(NewProblem(http.StatusConflict, ""))
+	})
+	r.GET("/nothing", func(c Control) {})
+	tests := []struct {
+		path string
+		result
+	}{
+		{"/write", result{http.StatusCreated, 11, true}},
+		{"/body", result{http.StatusAccepted, 8, true}},
+		{"/implicit", result{http.StatusOK, 2, true}},
+		{"/header", result{http.StatusNoContent, 0, true}},
+		{"/error", result{http.StatusConflict, int64(len(`{"status":409,"title":"Conflict","type":"about:blank"}`)), true}},
+		{"/nothing", result{0, 0, false}},
+	}
+	for _, test := range tests {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if before != (result{}) {
+			t.Error("Expected empty result before the handler, got", before, "for", test.path)
+		}
+		if after != test.result {
+			t.Error("Expected", test.result, "got", after, "for", test.path)
+		}
+	}
+}
+
+func TestControlTrackingCompression(t *testing.T) {
+	var size int64
+	var status int
+	r := NewRouter()
+	r.Use(func(next func(Control)) func(Control) {
+		return func(c Control) {
+			next(c)
+			status, size = c.StatusCode(), c.BytesWritten()
+		}
+	})
+	data := strings.Repeat("a", 4096)
+	r.GET("/large", func(c Control) {
+		c.Write([]byte(data))
+	})
+	r.GET("/small", func(c Control) {
+		c.WriteHeader(http.StatusAccepted)
+		c.Write([]byte("small"))
+		if !c.Written() || c.StatusCode() != http.StatusAccepted || c.BytesWritten() != 5 {
+			t.Error("Expected the buffered data is sent, got", c.Written(), c.StatusCode(), c.BytesWritten())
+		}
+	})
+	req := httptest.NewRequest("GET", "/large", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if status != http.StatusOK {
+		t.Error("Expected", http.StatusOK, "got", status)
+	}
+	if size != int64(len(data)) {
+		t.Error("Expected size of the data before compression", len(data), "got", size)
+	}
+	if encoding := trw.Header().Get("Content-Encoding"); encoding != "gzip" || trw.Body.Len() >= len(data) {
+		t.Error("Expected compressed reply, got", encoding, trw.Body.Len())
+	}
+	req = httptest.NewRequest("GET", "/small", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw = httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if trw.Code != http.StatusAccepted || trw.Body.String() != "small" {
+		t.Error("Expected", http.StatusAccepted, "small", "got", trw.Code, trw.Body.String())
+	}
+}
+
+func TestControlTrackingPending(t *testing.T) {
+	r := NewRouter()
+	part := strings.Repeat("a", 600)
+	r.GET("/stream", func(c Control) {
+		c.WriteHeader(http.StatusAccepted)
+		c.Write([]byte(part))
+		if !c.Written() || c.StatusCode() != http.StatusAccepted || c.BytesWritten() != int64(len(part)) {
+			t.Error("Expected the pending reply, got", c.Written(), c.StatusCode(), c.BytesWritten())
+		}
+		c.Write([]byte(part))
+	})
+	req := httptest.NewRequest("GET", "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	trw := httptest.NewRecorder()
+	r.ServeHTTP(trw, req)
+	if trw.Code != http.StatusAccepted {
+		t.Error("Expected", http.StatusAccepted, "got", trw.Code)
+	}
+	if encoding := trw.Header().Get("Content-Encoding"); encoding != "gzip" {
+		t.Error("Expected the reply is compressed after the check, got", encoding)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import "strings"
+
+// node is an element of the tree keyed by path segments. During the match
+// the static children are checked first, then the parameters and the wildcard.
+type node struct {
+	// Children with static segments
+	static map[string]*node
+
+	// Children with parameters, the constrained ones go first
+	params []*node
+
+	// Child which matches the rest of the path
+	wildcard *node
+
+	// Constraint of the parameter node e.g. `<int>`, it is empty for
+	// the parameters without constraints. The names of parameters
+	// are not a part of the tree, they are kept in the records.
+	constraint string
+
+	// Matcher of the parameter constraint
+	matcher matcher
+
+	// Route which ends at the node
+	record *record
+}
+
+// walk returns the node where the route of the record ends,
+// the missing nodes are created on the way.
+func (n *node) walk(rec *record) *node {
+	for idx, value := range rec.parts {
+		if value[0:1] == asterisk {
+			if n.wildcard == nil {
+				n.wildcard = new(node)
+			}
+			return n.wildcard
+		}
+		if value[0:1] == ":" {
+			n = n.param(value[len(rec.keys[idx]):], rec.matchers[idx])
+			continue
+		}
+		if n.static == nil {
+			n.static = make(map[string]*node)
+		}
+		child, ok := n.static[value]
+		if !ok {
+			child = new(node)
+			n.static[value] = child
+		}
+		n = child
+	}
+
+	return n
+}
+
+// param returns the child with the parameter constraint, the new child is created
+// if it doesn't exist. The constrained parameters are placed before the others.
+func (n *node) param(constraint string, m matcher) *node {
+	for _, child := range n.params {
+		if child.constraint == constraint {
+			return child
+		}
+	}
+	child := &node{constraint: constraint, matcher: m}
+	idx := len(n.params)
+	if constraint != "" {
+		for idx = 0; idx < len(n.params) && n.params[idx].constraint != ""; idx++ {
+		}
+	}
+	n.params = append(n.params, nil)
+	copy(n.params[idx+1:], n.params[idx:])
+	n.params[idx] = child
+
+	return child
+}
+
+// match walks the tree by segments of the path and keeps in the best
+// the record which takes priority over others. The number of parameters
+// passed on the way is used to skip the branches which cannot give
+// the better result.
+// If the fold is true, the static segments are compared case-insensitively.
+func (n *node) match(path string, dynamic uint16, fold bool, best **record) {
+	if *best != nil && !(*best).wildcard && dynamic >= (*best).dynamic() {
+		return
+	}
+	value, rest := segment(path)
+	if value == "" {
+		if n.record != nil && n.record.prior(*best) {
+			*best = n.record
+		}
+	} else {
+		if child, ok := n.static[value]; ok {
+			child.match(rest, dynamic, fold, best)
+		}
+		if fold {
+			for key, child := range n.static {
+				if key != value && strings.EqualFold(key, value) {
+					child.match(rest, dynamic, fold, best)
+				}
+			}
+		}
+		for _, child := range n.params {
+			if child.matcher == nil || child.matcher(value) {
+				child.match(rest, dynamic+1, fold, best)
+			}
+		}
+	}
+	if n.wildcard != nil && n.wildcard.record != nil && n.wildcard.record.prior(*best) {
+		*best = n.wildcard.record
+	}
+}
@@ -0,0 +1,66 @@
+package bit
+
+import "testing"
+
+func TestTreePriority(t *testing.T) {
+	p := newParser()
+	for _, path := range []string{
+		"/x/:b/:c",
+		"/:a/b/c",
+		"/static/*",
+		"/static/css/*",
+		"/static/:dir/*",
+		"/files/:name",
+		"/files/:id<int>",
+		"/:any/*",
+	} {
+		route := path
+		p.register(path, func(c Control) { c.Header().Set("Route", route) })
+	}
+	tests := []struct {
+		path, route string
+	}{
+		// less number of parameters takes priority
+		{"/x/b/c", "/:a/b/c"},
+		{"/x/y/z", "/x/:b/:c"},
+		// static segment takes priority over parameter and wildcard
+		{"/static/css/style.css", "/static/css/*"},
+		{"/static/js/app.js", "/static/*"},
+		{"/static", "/static/*"},
+		// constrained parameter is checked before the others
+		{"/files/12", "/files/:id<int>"},
+		{"/files/readme", "/files/:name"},
+		// routes without wildcard take priority
+		{"/files/readme/raw", "/:any/*"},
+	}
+	for _, test := range tests {
+		var rec *record
+		p.tree.match(test.path, 0, false, &rec)
+		if rec == nil {
+			t.Fatal("Expected route", test.route, "for", test.path)
+		}
+		if route := "/" + join(rec.parts); route != test.route {
+			t.Error("Expected", test.route, "got", route, "for", test.path)
+		}
+	}
+}
+
+func TestTreeWalk(t *testing.T) {
+	n := new(node)
+	first := &record{parts: []string{"users", ":id"}, keys: []string{"", ":id"}, matchers: make([]matcher, 2)}
+	second := &record{parts: []string{"users", ":name"}, keys: []string{"", ":name"}, matchers: make([]matcher, 2)}
+	target := n.walk(first)
+	target.record = first
+	if n.walk(second) != target {
+		t.Error("Expected the same node for", first.parts, "and", second.parts)
+	}
+	_, m, _ := parseParam(":id<int>")
+	n.walk(&record{parts: []string{"users", ":id<int>"}, keys: []string{"", ":id"}, matchers: []matcher{nil, m}})
+	params := n.static["users"].params
+	if len(params) != 2 {
+		t.Fatal("Expected 2 parameter nodes, got", len(params))
+	}
+	if params[0].constraint != "<int>" || params[1].constraint != "" {
+		t.Error("Expected constrained parameter first, got", params[0].constraint, params[1].constraint)
+	}
+}
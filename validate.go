@@ -0,0 +1,270 @@
+// Copyright 2017 Igor Dolzhikov. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package bit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes the field of the struct which failed the validation rule
+type FieldError struct {
+	XMLName xml.Name `json:"-" xml:"error" msgpack:"-"`
+	Field   string   `json:"field" xml:"field" msgpack:"field"`
+	Rule    string   `json:"rule" xml:"rule" msgpack:"rule"`
+	Param   string   `json:"param,omitempty" xml:"param,omitempty" msgpack:"param,omitempty"`
+	Message string   `json:"message" xml:"message" msgpack:"message"`
+}
+
+// ValidationErrors is returned by Control.Bind if the decoded struct
+// doesn't satisfy the rules of `validate` tags. If it is passed
+// to Control.Body, the status code 422 is used unless other code is set.
+type ValidationErrors []FieldError
+
+// Error implements error interface
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for idx, item := range e {
+		messages[idx] = item.Field + " " + item.Message
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// rule checks the value of the field, it returns an error
+// if the parameter of the rule is invalid
+type rule func(v reflect.Value, param string) (bool, error)
+
+// Predefined validation rules which may be used in the `validate` tag
+// e.g. `validate:"required,min=1,max=64"`
+var rules = map[string]rule{
+	"required": func(v reflect.Value, param string) (bool, error) { return !isEmptyValue(v), nil },
+	"min":      compare(func(size, limit float64) bool { return size >= limit }),
+	"max":      compare(func(size, limit float64) bool { return size <= limit }),
+	"len":      compare(func(size, limit float64) bool { return size == limit }),
+	"oneof":    isOneOf,
+	"email":    check(isEmail),
+	"url":      check(isURL),
+	"uuid":     check(isUUID),
+	"alpha":    check(isAlpha),
+	"alnum":    check(isAlnum),
+	"numeric":  check(isNumeric),
+}
+
+// Messages of the predefined rules, %s is replaced by the parameter
+var ruleMessages = map[string]string{
+	"required": "is required",
+	"min":      "must be at least %s",
+	"max":      "must be at most %s",
+	"len":      "must have length %s",
+	"oneof":    "must be one of: %s",
+	"email":    "must be a valid email address",
+	"url":      "must be a valid URL",
+	"uuid":     "must be a valid UUID",
+	"alpha":    "must contain only letters",
+	"alnum":    "must contain only letters and digits",
+	"numeric":  "must be a number",
+}
+
+// validate checks the struct pointed to by v by rules of `validate` tags.
+// The custom rules take priority over predefined ones.
+func validate(v interface{}, custom map[string]func(interface{}, string) bool) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs ValidationErrors
+	if err := validateStruct(rv, "", custom, &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func validateStruct(rv reflect.Value, prefix string, custom map[string]func(interface{}, string) bool, errs *ValidationErrors) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		field := rv.Field(i)
+		name := prefix + fieldName(sf)
+		if tag := sf.Tag.Get("validate"); tag != "" && tag != "-" {
+			if err := validateField(field, name, tag, custom, errs); err != nil {
+				return err
+			}
+		}
+		if field.Kind() == reflect.Ptr && !field.IsNil() {
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Struct {
+			nested := name + "."
+			if sf.Anonymous {
+				nested = prefix
+			}
+			if err := validateStruct(field, nested, custom, errs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateField applies the rules of the tag to the field until the first failed one
+func validateField(field reflect.Value, name, tag string, custom map[string]func(interface{}, string) bool, errs *ValidationErrors) error {
+	items := strings.Split(tag, ",")
+	for _, item := range items {
+		if strings.TrimSpace(item) == "omitempty" && isEmptyValue(field) {
+			return nil
+		}
+	}
+	for _, item := range items {
+		key, param := strings.TrimSpace(item), ""
+		if idx := strings.IndexByte(key, '='); idx >= 0 {
+			key, param = key[:idx], key[idx+1:]
+		}
+		if key == "" || key == "omitempty" {
+			continue
+		}
+		value := field
+		if key != "required" && value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		var ok bool
+		if f, found := custom[key]; found {
+			ok = f(value.Interface(), param)
+		} else if f, found := rules[key]; found {
+			var err error
+			if ok, err = f(value, param); err != nil {
+				return fmt.Errorf("rule %q of field %q: %v", key, name, err)
+			}
+		} else {
+			return fmt.Errorf("unknown validation rule %q of field %q", key, name)
+		}
+		if !ok {
+			*errs = append(*errs, FieldError{Field: name, Rule: key, Param: param, Message: ruleMessage(key, param)})
+			break
+		}
+	}
+
+	return nil
+}
+
+func ruleMessage(key, param string) string {
+	if message, ok := ruleMessages[key]; ok {
+		if strings.Contains(message, "%s") {
+			return fmt.Sprintf(message, param)
+		}
+		return message
+	}
+
+	return fmt.Sprintf("failed on the %q rule", key)
+}
+
+// fieldName returns the name of the field used in its representation:
+// `json`, `form`, `query` or `param` tag, the name of the field otherwise
+func fieldName(sf reflect.StructField) string {
+	for _, tag := range []string{"json", "form", "query", "param"} {
+		name := sf.Tag.Get(tag)
+		if idx := strings.IndexByte(name, ','); idx >= 0 {
+			name = name[:idx]
+		}
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return sf.Name
+}
+
+// compare makes the rule which compares the size of the value with the parameter:
+// the length of strings, slices and maps or the value of numbers
+func compare(cmp func(size, limit float64) bool) rule {
+	return func(v reflect.Value, param string) (bool, error) {
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid parameter %q", param)
+		}
+		var size float64
+		switch v.Kind() {
+		case reflect.String:
+			size = float64(utf8.RuneCountInString(v.String()))
+		case reflect.Slice, reflect.Map, reflect.Array:
+			size = float64(v.Len())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			size = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			size = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			size = v.Float()
+		default:
+			return false, fmt.Errorf("unsupported type %s", v.Type())
+		}
+
+		return cmp(size, limit), nil
+	}
+}
+
+// check makes the rule which checks the string value by the matcher
+func check(m matcher) rule {
+	return func(v reflect.Value, param string) (bool, error) {
+		if v.Kind() != reflect.String {
+			return false, fmt.Errorf("unsupported type %s", v.Type())
+		}
+
+		return m(v.String()), nil
+	}
+}
+
+// isOneOf checks that the value is one of the space separated values of the parameter
+func isOneOf(v reflect.Value, param string) (bool, error) {
+	value := fmt.Sprint(v.Interface())
+	for _, item := range strings.Fields(param) {
+		if item == value {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+
+	return err == nil && addr.Address == s && strings.Contains(s[strings.LastIndexByte(s, '@'):], ".")
+}
+
+func isURL(s string) bool {
+	u, err := url.ParseRequestURI(s)
+
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+
+	// NaN and infinity are not numbers in terms of user input
+	return err == nil && !strings.ContainsAny(s, "nNiI")
+}
@@ -0,0 +1,169 @@
+package bit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type validateAddress struct {
+	City string `json:"city" validate:"required,alpha"`
+	Zip  string `json:"zip" validate:"omitempty,numeric,len=5"`
+}
+
+type validateUser struct {
+	ID      string           `param:"id" validate:"omitempty,uuid"`
+	Name    string           `json:"name" validate:"required,min=2,max=8"`
+	Email   string           `json:"email" validate:"omitempty,email"`
+	Age     int              `json:"age" validate:"min=18,max=99"`
+	Role    string           `json:"role" validate:"oneof=admin user"`
+	Tags    []string         `json:"tags" validate:"max=2"`
+	Site    *string          `json:"site" validate:"url"`
+	Login   string           `json:"login" validate:"omitempty,alnum"`
+	Address *validateAddress `json:"address" validate:"required"`
+}
+
+var validateTests = []struct {
+	data   string
+	errors []string
+}{
+	{
+		`{"name":"John","age":32,"role":"user","address":{"city":"Paris"}}`,
+		nil,
+	},
+	{
+		`{"email":"john@example.com","age":18,"role":"admin","tags":["a","b"],"site":"https://example.com",` +
+			`"login":"john1","address":{"city":"Paris","zip":"75001"}}`,
+		[]string{"name required"},
+	},
+	{
+		`{"name":"J","email":"john","age":17,"role":"guest","tags":["a","b","c"],"site":"example",` +
+			`"login":"john_1","address":{"city":"Paris1","zip":"7500"}}`,
+		[]string{"name min 2", "email email", "age min 18", "role oneof admin user", "tags max 2", "site url",
+			"login alnum", "address.city alpha", "address.zip len 5"},
+	},
+	{
+		`{"name":"Jonathan Smith","age":100,"role":"user"}`,
+		[]string{"name max 8", "age max 99", "address required"},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range validateTests {
+		var user validateUser
+		if err := json.Unmarshal([]byte(test.data), &user); err != nil {
+			t.Fatal(err)
+		}
+		err := validate(&user, nil)
+		if test.errors == nil {
+			if err != nil {
+				t.Error("Expected nil error for", test.data, "got", err)
+			}
+			continue
+		}
+		errs, ok := err.(ValidationErrors)
+		if !ok {
+			t.Error("Expected ValidationErrors for", test.data, "got", err)
+			continue
+		}
+		var result []string
+		for _, item := range errs {
+			result = append(result, strings.TrimSpace(item.Field+" "+item.Rule+" "+item.Param))
+		}
+		if strings.Join(result, ", ") != strings.Join(test.errors, ", ") {
+			t.Error("Expected", test.errors, "got", result)
+		}
+	}
+}
+
+func TestValidateInvalidRules(t *testing.T) {
+	var unknown struct {
+		Name string `validate:"unknown"`
+	}
+	if err := validate(&unknown, nil); err == nil || err.Error() != `unknown validation rule "unknown" of field "Name"` {
+		t.Error("Expected unknown rule error, got", err)
+	}
+	var param struct {
+		Name string `validate:"min=x"`
+	}
+	if _, ok := validate(&param, nil).(ValidationErrors); ok {
+		t.Error("Expected error of invalid parameter, got ValidationErrors")
+	}
+	var kind struct {
+		Count int `validate:"email"`
+	}
+	if _, ok := validate(&kind, nil).(ValidationErrors); ok {
+		t.Error("Expected error of unsupported type, got ValidationErrors")
+	}
+}
+
+func TestValidateRulesMessages(t *testing.T) {
+	errs := ValidationErrors{
+		{Field: "name", Rule: "required", Message: ruleMessage("required", "")},
+		{Field: "age", Rule: "min", Param: "18", Message: ruleMessage("min", "18")},
+		{Field: "code", Rule: "custom", Message: ruleMessage("custom", "")},
+	}
+	expected := `name is required; age must be at least 18; code failed on the "custom" rule`
+	if errs.Error() != expected {
+		t.Error("Expected", expected, "got", errs.Error())
+	}
+}
+
+func TestBindValidation(t *testing.T) {
+	r := getRouterForTesting()
+	r.SetupValidator("prefix", func(value interface{}, param string) bool {
+		s, ok := value.(string)
+		return ok && strings.HasPrefix(s, param)
+	})
+	r.POST("/users/:id", func(c Control) {
+		var user struct {
+			ID   string `param:"id" validate:"prefix=usr_"`
+			Name string `json:"name" validate:"required"`
+		}
+		if err := c.Bind(&user); err != nil {
+			c.Body(err)
+			return
+		}
+		c.Body(user.ID)
+	})
+	for _, test := range []struct {
+		path, body, expected string
+		code                 int
+	}{
+		{"/users/usr_1", `{"name":"John"}`, "usr_1", http.StatusOK},
+		{"/users/1", `{}`,
+			`[{"field":"id","rule":"prefix","param":"usr_","message":"failed on the \"prefix\" rule"},` +
+				`{"field":"name","rule":"required","message":"is required"}]`,
+			http.StatusUnprocessableEntity,
+		},
+	} {
+		req := httptest.NewRequest("POST", test.path, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		trw := httptest.NewRecorder()
+		r.ServeHTTP(trw, req)
+		if trw.Code != test.code {
+			t.Error("Expected", test.code, "got", trw.Code)
+		}
+		if trw.Body.String() != test.expected {
+			t.Error("Expected", test.expected, "got", trw.Body.String())
+		}
+	}
+}
+
+func TestValidationErrorsCode(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/xml")
+	trw := httptest.NewRecorder()
+	c := NewControl(trw, req)
+	c.Code(http.StatusBadRequest)
+	c.Body(ValidationErrors{{Field: "name", Rule: "required", Message: "is required"}})
+	if trw.Code != http.StatusBadRequest {
+		t.Error("Expected", http.StatusBadRequest, "got", trw.Code)
+	}
+	expected := "<error><field>name</field><rule>required</rule><message>is required</message></error>"
+	if trw.Body.String() != expected {
+		t.Error("Expected", expected, "got", trw.Body.String())
+	}
+}